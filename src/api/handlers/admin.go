@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"social/models"
+	"social/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetUserRole назначает роль пользователю (только для администраторов)
+func SetUserRole(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request SetRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Администратор не может снять роль сам с себя, чтобы не остаться без администраторов
+	if currentUserID, _ := c.Get("user_id"); currentUserID == userID && models.Role(request.Role) != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot downgrade own role"})
+		return
+	}
+
+	err = services.SetUserRole(c.Request.Context(), userID, models.Role(request.Role))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be one of: user, moderator, admin"})
+			return
+		}
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "user_id": userID, "role": request.Role})
+}
@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"social/models"
 	"social/services"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type LoginRequest struct {
-	Nickname string `json:"nickname" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Nickname   string `json:"nickname" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name"`
 }
 
 type LoginResponse struct {
@@ -29,29 +33,57 @@ type RegisterRequest struct {
 	Sex       string    `json:"sex" binding:"required"`
 	Interests []string  `json:"interests"`
 	City      string    `json:"city" binding:"required"`
+	Email     string    `json:"email" binding:"omitempty,email"`
 }
 
 type TokenRefreshRequest struct {
-	Nickname string `json:"nickname" binding:"required"`
-	Token    string `json:"token" binding:"required"`
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-type LogoutRequest struct {
-	Nickname string `json:"nickname" binding:"required"`
-	Token    string `json:"token" binding:"required"`
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Login string `json:"login" binding:"required"` // никнейм или email
+}
+
+type PasswordResetConfirmRequest struct {
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 type LogoutResponse struct {
 	Status string `json:"status"`
 }
 
+// SessionResponse - активная сессия пользователя с признаком текущей
+type SessionResponse struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+// rejectThrottled отвечает 429, если попытка отклонена защитой от перебора
+func rejectThrottled(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later", "retry_after": seconds})
+}
+
 func Register(c *gin.Context) {
 	var err error
 	var registerRequest RegisterRequest
+	ctx := c.Request.Context()
 	if err = c.ShouldBindJSON(&registerRequest); err != nil {
+		services.RecordAuthFailure(ctx, services.AuthScopeRegister, "", c.ClientIP())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
 		return
 	}
+	if retryAfter := services.CheckAuthAttempt(ctx, services.AuthScopeRegister, registerRequest.Nickname, c.ClientIP()); retryAfter > 0 {
+		rejectThrottled(c, retryAfter)
+		return
+	}
 
 	newUser := models.User{
 		Nickname:  registerRequest.Nickname,
@@ -60,16 +92,21 @@ func Register(c *gin.Context) {
 		Password:  registerRequest.Password,
 		Sex:       models.Sex(registerRequest.Sex),
 		City:      registerRequest.City,
+		Email:     registerRequest.Email,
 	}
 
 	if !registerRequest.Birthday.IsZero() {
 		newUser.Birthday = registerRequest.Birthday
 	}
 
-	if registerRequest.Interests != nil {
-		var newInterests []models.Interest
-		for _, interest := range registerRequest.Interests {
-			newInterests = append(newInterests, models.Interest{Name: interest})
+	if len(registerRequest.Interests) > services.MAX_USER_INTERESTS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTooManyInterests.Error()})
+		return
+	}
+	for _, interest := range registerRequest.Interests {
+		if _, err := services.NormalizeInterest(interest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interest: " + interest})
+			return
 		}
 	}
 
@@ -82,6 +119,7 @@ func Register(c *gin.Context) {
 	userId, err := userHandler.Register()
 	if err != nil {
 		if err.Error() == "user already exists" {
+			services.RecordAuthFailure(ctx, services.AuthScopeRegister, registerRequest.Nickname, c.ClientIP())
 			c.JSON(http.StatusBadRequest, gin.H{"error": "dbModel already exists"})
 			return
 		}
@@ -89,20 +127,17 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	if registerRequest.Interests != nil {
-		interestHandler := services.InterestHandler{
-			Model: &models.Interest{},
-		}
-		for _, interest := range registerRequest.Interests {
-			interestHandler.Model.Name = interest
-			if err := interestHandler.Create(); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create interest"})
-				return
-			}
-			interestHandler.SetToUser(*userId)
+	if len(registerRequest.Interests) > 0 {
+		if _, err := services.AddUserInterests(ctx, *userId, registerRequest.Interests); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save interests"})
+			return
 		}
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userId,
+		"message": "User registered successfully",
+	})
 }
 
 func Login(c *gin.Context) {
@@ -112,49 +147,219 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+	if retryAfter := services.CheckAuthAttempt(ctx, services.AuthScopeLogin, loginRequest.Nickname, c.ClientIP()); retryAfter > 0 {
+		rejectThrottled(c, retryAfter)
+		return
+	}
+
 	userHandler := services.UserHandler{
 		Nickname: &loginRequest.Nickname,
 		Password: &loginRequest.Password,
+		Device: &services.DeviceInfo{
+			DeviceName: loginRequest.DeviceName,
+			UserAgent:  c.Request.UserAgent(),
+			IP:         c.ClientIP(),
+		},
 	}
 
-	token, err := userHandler.Login()
+	tokens, err := userHandler.Login()
 	if err != nil {
 		if err.Error() == "invalid nickname" || err.Error() == "invalid password" {
+			services.RecordAuthFailure(ctx, services.AuthScopeLogin, loginRequest.Nickname, c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	services.ResetAuthFailures(ctx, services.AuthScopeLogin, loginRequest.Nickname)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Login successful",
-		"token":    token,
-		"nickname": userHandler.Nickname})
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_in": tokens.RefreshExpiresIn,
+		"session_id":         tokens.SessionID,
+		"nickname":           userHandler.Nickname})
 }
 
-func Logout(c *gin.Context) {
-	var logoutRequest LogoutRequest
-	if err := c.ShouldBindJSON(&logoutRequest); err != nil {
+// RefreshToken обменивает refresh-токен на новую пару токенов
+func RefreshToken(c *gin.Context) {
+	var refreshRequest TokenRefreshRequest
+	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	userHandler := services.UserHandler{
-		Nickname: &logoutRequest.Nickname,
-		Token:    &logoutRequest.Token,
-	}
-	err := userHandler.Logout()
+	tokens, err := services.RefreshTokens(c.Request.Context(), refreshRequest.RefreshToken)
 	if err != nil {
-		if err.Error() == "token is empty" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Token is empty"})
+		if errors.Is(err, services.ErrTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session revoked"})
 			return
 		}
-		if err.Error() == "user not found" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		if errors.Is(err, services.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_in": tokens.RefreshExpiresIn,
+		"session_id":         tokens.SessionID,
+	})
+}
+
+// Logout завершает сессию, к которой относится предъявленный токен
+func Logout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No session associated with token"})
+		return
+	}
+
+	err := services.RevokeSession(c.Request.Context(), userID.(int64), sessionID)
+	if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
 }
+
+// ListSessions возвращает активные сессии текущего пользователя
+func ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := services.ListSessions(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	currentSessionID := c.GetString("session_id")
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			UserSession: session,
+			Current:     session.ID == currentSessionID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession завершает одну из сессий текущего пользователя
+func RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := services.RevokeSession(c.Request.Context(), userID.(int64), c.Param("session_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions завершает все сессии текущего пользователя, кроме текущей
+func RevokeOtherSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No session associated with token"})
+		return
+	}
+
+	revoked, err := services.RevokeOtherSessions(c.Request.Context(), userID.(int64), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": revoked})
+}
+
+// ChangePassword меняет пароль текущего пользователя и завершает остальные его сессии
+func ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	err := services.ChangePassword(c.Request.Context(), userID.(int64), c.GetString("session_id"),
+		request.OldPassword, request.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid current password"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// RequestPasswordReset отправляет код сброса пароля на почту пользователя.
+// Ответ не зависит от того, найден ли пользователь
+func RequestPasswordReset(c *gin.Context) {
+	var request PasswordResetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := services.RequestPasswordReset(c.Request.Context(), request.Login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a reset code has been sent"})
+}
+
+// ConfirmPasswordReset устанавливает новый пароль по коду сброса
+func ConfirmPasswordReset(c *gin.Context) {
+	var request PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := services.ResetPassword(c.Request.Context(), request.Code, request.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"social/api/middleware"
 	"social/config"
 	"social/services"
 	"strconv"
@@ -83,6 +85,20 @@ func reassignUserToShard(userID int64, newShardID int) error {
 	return db.ORM.Save(&shardMap).Error
 }
 
+// checkCanMessage проверяет настройки приватности получателя; при запрете отвечает 403 и возвращает false
+func checkCanMessage(c *gin.Context, fromUserID, toUserID int64) bool {
+	err := services.CheckCanMessage(c.Request.Context(), fromUserID, toUserID)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, services.ErrMessagesNotAllowed) || errors.Is(err, services.ErrUserBlocked) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+	return false
+}
+
 func SendMessagePublicHandler(c *gin.Context) {
 	fromUserID, exists := c.Get("user_id")
 	if !exists {
@@ -105,6 +121,11 @@ func SendMessagePublicHandler(c *gin.Context) {
 		return
 	}
 
+	// Настройки приватности проверяются до асинхронной отправки, чтобы вернуть понятную ошибку
+	if !checkCanMessage(c, fromUserID.(int64), toUserID) {
+		return
+	}
+
 	go func() {
 		//	отправляем данные во внутренний сервис
 		internalReq := SendMessageInternalRequest{
@@ -120,8 +141,8 @@ func SendMessagePublicHandler(c *gin.Context) {
 				fmt.Sprintf("Failed to send message. ReqId=%s", internalReq.RequestID))
 			return
 		}
-		// отправляем запрос в сервис диалогов
-		httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/messages/send", config.AppConfig.DialogServiceURL), bytes.NewBuffer(reqBody))
+		// отправляем подписанный запрос в сервис диалогов
+		httpReq, err := newDialogServiceRequest("/v1/messages/send", reqBody)
 		if err != nil {
 			_ = services.SendWsNotify(fromUserID.(int64), "internal_error",
 				fmt.Sprintf("Failed to create request. ReqId=%s: %v",
@@ -129,8 +150,13 @@ func SendMessagePublicHandler(c *gin.Context) {
 			log.Printf("DIALOG: failed to create http request: %v+", err)
 			return
 		}
-		httpReq.Header.Set("Content-Type", "application/json")
-		_, err = client.Do(httpReq)
+		resp, err := client.Do(httpReq)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("dialog service responded with status %d", resp.StatusCode)
+			}
+		}
 		if err != nil {
 			// при ошибке показываем пользователю уведомление
 			_ = services.SendWsNotify(fromUserID.(int64), "internal_error",
@@ -154,6 +180,11 @@ func SendMessageInternalHandler(c *gin.Context) {
 	fromUserID := req.From
 	toUserID := req.To
 
+	if !checkCanMessage(c, fromUserID, toUserID) {
+		log.Printf("DIALOG: reqId %s; message from %d to %d rejected by privacy settings", req.RequestID, fromUserID, toUserID)
+		return
+	}
+
 	// Используем SAGA для обеспечения консистентности счетчиков
 	sagaService := services.GetCounterSagaService()
 	if err := sagaService.HandleNewMessage(fromUserID, toUserID, req.Text); err != nil {
@@ -238,21 +269,46 @@ func ListDialogPublicHandler(c *gin.Context) {
 	}
 	client := &http.Client{Timeout: 10 * time.Second}
 	reqBody, _ := json.Marshal(internalReq)
-	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/messages/list/%d",
-		config.AppConfig.DialogServiceURL, otherUserID), bytes.NewBuffer(reqBody))
+	httpReq, err := newDialogServiceRequest("/v1/messages/list", reqBody)
 	if err != nil {
+		log.Printf("DIALOG: failed to create http request: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
 		return
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	_, err = client.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
 		return
 	}
+	defer resp.Body.Close()
+
+	var internalResp struct {
+		Messages []models.Message `json:"messages"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&internalResp) != nil {
+		log.Printf("DIALOG: list messages failed with status %d", resp.StatusCode)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+	if internalResp.Messages == nil {
+		internalResp.Messages = []models.Message{}
+	}
 	// TODO: нужно кешировать ответ от внутреннего сервиса. Для инвалидации кеша можно запрашивать "быстрые" данные,
 	// например ID последнего сообщения. Если он не изменился - возвращать список сообщений из кеша.
-	c.JSON(http.StatusOK, gin.H{"messages": []models.Message{}})
+	c.JSON(http.StatusOK, gin.H{"messages": internalResp.Messages})
+}
+
+// newDialogServiceRequest создает подписанный запрос к внутреннему API сервиса диалогов
+func newDialogServiceRequest(path string, body []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequest("POST", config.AppConfig.DialogServiceURL+path, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if err := middleware.SignServiceRequest(httpReq, body, config.GetServiceAuthConfig().Secret); err != nil {
+		return nil, err
+	}
+	return httpReq, nil
 }
 
 // ListDialogInternalHandler - получение сообщений между пользователями (диалога)
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDataExport запускает выгрузку персональных данных текущего пользователя
+func RequestDataExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	export, err := services.RequestDataExport(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"export": export})
+}
+
+// GetDataExport возвращает статус выгрузки
+func GetDataExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	export, err := services.GetDataExport(c.Request.Context(), userID.(int64), c.Param("export_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrExportNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+// DownloadDataExport отдает готовый архив выгрузки
+func DownloadDataExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	exportID := c.Param("export_id")
+	path, err := services.GetDataExportFile(c.Request.Context(), userID.(int64), exportID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrExportNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		case errors.Is(err, services.ErrExportNotReady):
+			c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready yet"})
+		case errors.Is(err, services.ErrExportExpired):
+			c.JSON(http.StatusGone, gin.H{"error": "Export has expired"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("data_export_%s.zip", exportID))
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FollowUserRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// FollowUser подписывает текущего пользователя на посты другого пользователя
+func FollowUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req FollowUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.FollowUser(c.Request.Context(), userID.(int64), req.UserID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrCannotFollowSelf):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrUserBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User followed"})
+}
+
+// UnfollowUser отменяет подписку на пользователя
+func UnfollowUser(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	followeeID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if err := services.UnfollowUser(c.Request.Context(), userID.(int64), followeeID); err != nil {
+		if errors.Is(err, services.ErrFollowNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unfollowed"})
+}
+
+// ListFollowers возвращает количество и список подписчиков пользователя (?limit=&offset=)
+func ListFollowers(c *gin.Context) {
+	listFollows(c, services.ListFollowers)
+}
+
+// ListFollowing возвращает количество и список подписок пользователя (?limit=&offset=)
+func ListFollowing(c *gin.Context) {
+	listFollows(c, services.ListFollowing)
+}
+
+func listFollows(c *gin.Context, list func(ctx context.Context, viewerID, userID int64, limit, offset int) (services.FollowList, error)) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ownerID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	follows, err := list(c.Request.Context(), userID.(int64), ownerID, limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrProfileHidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": "This profile is private"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": follows.Count, "users": follows.Users, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"social/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMutualFriends возвращает количество и список общих друзей с пользователем (?limit=&offset=)
+func GetMutualFriends(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	otherID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	mutual, err := services.GetMutualFriends(c.Request.Context(), userID.(int64), otherID, limit, offset)
+	if err != nil {
+		respondFriendGraphError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": mutual.Count, "friends": mutual.Friends, "limit": limit, "offset": offset})
+}
+
+// GetFriendshipDegree возвращает степень связи с пользователем: 1, 2, 3 или 0, если связи нет
+func GetFriendshipDegree(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	otherID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	degree, err := services.GetFriendshipDegree(c.Request.Context(), userID.(int64), otherID)
+	if err != nil {
+		respondFriendGraphError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": otherID, "degree": degree})
+}
+
+func respondFriendGraphError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrCompareWithSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrProfileHidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "This profile is private"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"social/services"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,7 +30,16 @@ func AddFriend(c *gin.Context) {
 	}
 
 	if err := friendService.AddFriend(userID.(int64), r.FriendID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, services.ErrFriendRequestsNotAllowed) || errors.Is(err, services.ErrUserBlocked):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAlreadyFriends) || errors.Is(err, services.ErrFriendRequestExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrFriendRequestCooldown):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "friend request sent"})
@@ -53,12 +64,72 @@ func ApproveFriend(c *gin.Context) {
 	}
 
 	if err := friendService.ApproveFriend(userID.(int64), r.FriendID); err != nil {
+		if errors.Is(err, services.ErrFriendRequestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "friendship approved"})
 }
 
+// RejectFriend - обработчик для отклонения входящей заявки
+func RejectFriend(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	type req struct {
+		FriendID int64 `json:"friend_id"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	if err := friendService.RejectFriend(userID.(int64), r.FriendID); err != nil {
+		if errors.Is(err, services.ErrFriendRequestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "friend request rejected"})
+}
+
+// CancelFriendRequest - обработчик для отзыва своей заявки
+func CancelFriendRequest(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	type req struct {
+		FriendID int64 `json:"friend_id"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	if err := friendService.CancelFriendRequest(userID.(int64), r.FriendID); err != nil {
+		if errors.Is(err, services.ErrFriendRequestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "friend request canceled"})
+}
+
 // DeleteFriend - обработчик для удаления друга
 func DeleteFriend(c *gin.Context) {
 	// Получаем user_id из контекста (устанавливается middleware)
@@ -84,36 +155,81 @@ func DeleteFriend(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "friend deleted"})
 }
 
-// GetFriends - обработчик для получения списка друзей
+// GetFriends - обработчик для получения списка друзей (?sort=recent|alpha&limit=&cursor=)
 func GetFriends(c *gin.Context) {
+	listFriendProfiles(c, "friends", friendService.GetFriends)
+}
+
+// GetPendingRequests - обработчик для получения входящих заявок в друзья (?sort=recent|alpha&limit=&cursor=)
+func GetPendingRequests(c *gin.Context) {
+	listFriendProfiles(c, "requests", friendService.GetPendingRequests)
+}
+
+// listFriendProfiles отдает страницу списка под ключом key; следующая страница запрашивается по next_cursor
+func listFriendProfiles(c *gin.Context, key string, list func(userID int64, params services.FriendListParams) (*services.FriendList, error)) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	friends, err := friendService.GetFriends(userID.(int64))
+	params := services.FriendListParams{
+		Sort:   c.Query("sort"),
+		Limit:  50,
+		Cursor: c.Query("cursor"),
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= services.MAX_FRIEND_LIST_LIMIT {
+			params.Limit = l
+		}
+	}
+
+	result, err := list(userID.(int64), params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, services.ErrInvalidFriendSort):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort"})
+		case errors.Is(err, services.ErrInvalidCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"friends": friends})
+	response := gin.H{key: result.Users}
+	if result.NextCursor != "" {
+		response["next_cursor"] = result.NextCursor
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// GetPendingRequests - обработчик для получения входящих заявок в друзья
-func GetPendingRequests(c *gin.Context) {
+// GetOutgoingRequests - обработчик для получения исходящих заявок (?limit=&offset=)
+func GetOutgoingRequests(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	requests, err := friendService.GetPendingRequests(userID.(int64))
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	requests, err := friendService.GetOutgoingRequests(userID.(int64), limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"requests": requests})
+	c.JSON(http.StatusOK, gin.H{"requests": requests, "limit": limit, "offset": offset})
 }
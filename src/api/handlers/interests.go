@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"social/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AddInterestsRequest struct {
+	Interests []string `json:"interests" binding:"required,min=1"`
+}
+
+// ListInterests возвращает интересы для автодополнения (?q=префикс)
+func ListInterests(c *gin.Context) {
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	interests, err := services.ListInterests(c.Request.Context(), c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"interests": interests})
+}
+
+// GetMyInterests возвращает интересы текущего пользователя
+func GetMyInterests(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	interests, err := services.GetUserInterests(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"interests": interests})
+}
+
+// AddMyInterests добавляет интересы текущему пользователю
+func AddMyInterests(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req AddInterestsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	interests, err := services.AddUserInterests(c.Request.Context(), userID.(int64), req.Interests)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInterest), errors.Is(err, services.ErrTooManyInterests):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"interests": interests})
+}
+
+// RemoveMyInterest убирает интерес у текущего пользователя
+func RemoveMyInterest(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	interestID, err := strconv.ParseInt(c.Param("interest_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interest ID"})
+		return
+	}
+
+	if err := services.RemoveUserInterest(c.Request.Context(), userID.(int64), interestID); err != nil {
+		if errors.Is(err, services.ErrInterestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Interest not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Interest removed"})
+}
+
+// UserSearchByInterests ищет пользователей с общими интересами
+// (?interests=a,b; match=all - только пользователи со всеми перечисленными интересами)
+func UserSearchByInterests(c *gin.Context) {
+	names := queryInterests(c)
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one interest is required"})
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	users, err := services.SearchUsersByInterests(c.Request.Context(), viewerID(c), names, c.Query("match") == "all", limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInterest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interest"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	userInfos := []UserInfo{}
+	for _, user := range users {
+		userInfos = append(userInfos, UserInfo{
+			ID:        user.ID,
+			Nickname:  user.Nickname,
+			Firstname: user.FirstName,
+			Lastname:  user.LastName,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"users": userInfos, "limit": limit, "offset": offset})
+}
+
+// queryInterests собирает названия интересов из параметра interests (через запятую или повтором параметра)
+func queryInterests(c *gin.Context) []string {
+	var names []string
+	for _, value := range c.QueryArray("interests") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"social/config"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetAvatarRequest struct {
+	MediaID string `json:"media_id" binding:"required"`
+}
+
+// mediaResponse - загруженное изображение со ссылками на оригинал и превью
+func mediaResponse(media *models.Media) gin.H {
+	return gin.H{
+		"id":            media.ID,
+		"kind":          media.Kind,
+		"content_type":  media.ContentType,
+		"size":          media.Size,
+		"width":         media.Width,
+		"height":        media.Height,
+		"url":           services.MediaURL(media.ID),
+		"thumbnail_url": services.MediaThumbnailURL(media.ID),
+		"created_at":    media.CreatedAt,
+	}
+}
+
+// UploadMedia загружает изображение (multipart-поле file). Поле kind: post (по умолчанию) или avatar
+func UploadMedia(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	maxSize := config.GetMediaConfig().MaxSize
+	// Запас на заголовки multipart; точный размер файла проверяет сервис
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+64*1024)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	kind := c.DefaultPostForm("kind", models.MediaKindPost)
+	media, err := services.UploadMedia(c.Request.Context(), userID.(int64), kind, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMediaKind):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be 'post' or 'avatar'"})
+		case errors.Is(err, services.ErrMediaTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		case errors.Is(err, services.ErrUnsupportedMedia):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only JPEG, PNG and GIF images are supported"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"media": mediaResponse(media)})
+}
+
+// GetMedia отдает оригинал изображения
+func GetMedia(c *gin.Context) {
+	serveMedia(c, false)
+}
+
+// GetMediaThumbnail отдает превью изображения
+func GetMediaThumbnail(c *gin.Context) {
+	serveMedia(c, true)
+}
+
+func serveMedia(c *gin.Context, thumbnail bool) {
+	body, contentType, err := services.OpenMedia(c.Request.Context(), c.Param("media_id"), thumbnail)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer body.Close()
+
+	// Файлы по ID никогда не меняются
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, body, nil)
+}
+
+// SetAvatar делает загруженное изображение (kind=avatar) аватаром текущего пользователя
+func SetAvatar(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req SetAvatarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.SetAvatar(c.Request.Context(), userID.(int64), req.MediaID); err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"avatar_url": services.MediaURL(req.MediaID)})
+}
+
+// RemoveAvatar убирает аватар текущего пользователя
+func RemoveAvatar(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := services.SetAvatar(c.Request.Context(), userID.(int64), ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed"})
+}
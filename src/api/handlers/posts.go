@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"social/services"
 	"strconv"
@@ -13,10 +14,11 @@ var postService = services.NewPostService()
 // CreatePost создает новый пост
 func CreatePost(c *gin.Context) {
 	var req struct {
-		Content string `json:"content" binding:"required"`
+		Content  string   `json:"content"`
+		MediaIDs []string `json:"media_ids"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Content == "" && len(req.MediaIDs) == 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -28,9 +30,16 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 
-	post, err := postService.CreatePost(c.Request.Context(), userID.(int64), req.Content)
+	post, err := postService.CreatePost(c.Request.Context(), userID.(int64), req.Content, req.MediaIDs...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
+		switch {
+		case errors.Is(err, services.ErrMediaNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Media not found or already attached"})
+		case errors.Is(err, services.ErrTooManyPostMedia):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
+		}
 		return
 	}
 
@@ -145,6 +154,87 @@ func DeletePost(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
 
+// UpdatePost редактирует текст поста автора, сохраняя предыдущую версию в истории
+func UpdatePost(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	postID, err := strconv.ParseInt(c.Param("post_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	// Пустой текст допустим для поста с изображениями, поэтому проверяем только наличие поля
+	var req struct {
+		Content *string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Content == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	post, err := postService.UpdatePost(c.Request.Context(), userID.(int64), postID, *req.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPostNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		case errors.Is(err, services.ErrPostContentEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPostEditConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// GetPostRevisions возвращает пост и историю его правок, начиная с последней
+func GetPostRevisions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	postID, err := strconv.ParseInt(c.Param("post_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	history, err := postService.GetPostHistory(c.Request.Context(), userID.(int64), postID, limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
 // GetQueueStats возвращает статистику очереди (админский эндпоинт)
 func GetQueueStats(c *gin.Context) {
 	if services.QueueServiceInstance == nil {
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"social/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPresence возвращает онлайн-статус и время последнего визита пользователей (?ids=1,2,3).
+// Пользователи, скрывшие статус от запрашивающего, в ответ не попадают
+func GetPresence(c *gin.Context) {
+	var userIDs []int64
+	for _, value := range c.QueryArray("ids") {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID: " + part})
+				return
+			}
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		return
+	}
+
+	presence, err := services.GetPresence(c.Request.Context(), viewerID(c), userIDs)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyPresenceIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids are allowed", services.MAX_PRESENCE_BATCH)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"presence": presence})
+}
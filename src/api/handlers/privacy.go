@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdatePrivacyRequest - частичное изменение настроек приватности
+type UpdatePrivacyRequest struct {
+	Messages       *string `json:"messages"`
+	Profile        *string `json:"profile"`
+	Birthday       *string `json:"birthday"`
+	FriendRequests *string `json:"friend_requests"`
+	Presence       *string `json:"presence"`
+}
+
+// GetPrivacySettings возвращает настройки приватности текущего пользователя
+func GetPrivacySettings(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	settings, err := services.GetPrivacySettings(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"privacy": settings})
+}
+
+// UpdatePrivacySettings меняет переданные настройки приватности текущего пользователя
+func UpdatePrivacySettings(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	settings, err := services.UpdatePrivacySettings(c.Request.Context(), userID.(int64), services.PrivacyUpdate{
+		Messages:       req.Messages,
+		Profile:        req.Profile,
+		Birthday:       req.Birthday,
+		FriendRequests: req.FriendRequests,
+		Presence:       req.Presence,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPrivacySetting) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "messages, profile, birthday and presence must be 'everyone', 'friends' or 'nobody'; " +
+				"friend_requests must be 'everyone', 'friends_of_friends' or 'nobody'"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"privacy": settings})
+}
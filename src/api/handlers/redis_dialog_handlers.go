@@ -24,17 +24,12 @@ type RedisSendMessageRequest struct {
 }
 
 func (h *RedisDialogHandlers) SendMessageHandler(c *gin.Context) {
-	fromUserIDStr, exists := c.Get("user_id")
+	fromUserIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-
-	fromUserID, err := strconv.ParseInt(fromUserIDStr.(string), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from user_id"})
-		return
-	}
+	fromUserID := fromUserIDVal.(int64)
 
 	toUserIDStr := c.Param("user_id")
 	toUserID, err := strconv.ParseInt(toUserIDStr, 10, 64)
@@ -49,6 +44,10 @@ func (h *RedisDialogHandlers) SendMessageHandler(c *gin.Context) {
 		return
 	}
 
+	if !checkCanMessage(c, fromUserID, toUserID) {
+		return
+	}
+
 	message, err := h.redisService.SendMessage(fromUserID, toUserID, req.Text)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
@@ -62,17 +61,12 @@ func (h *RedisDialogHandlers) SendMessageHandler(c *gin.Context) {
 }
 
 func (h *RedisDialogHandlers) ListDialogHandler(c *gin.Context) {
-	userIDStr, exists := c.Get("user_id")
+	userIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-
-	userID, err := strconv.ParseInt(userIDStr.(string), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from user_id"})
-		return
-	}
+	userID := userIDVal.(int64)
 
 	otherUserIDStr := c.Param("user_id")
 	otherUserID, err := strconv.ParseInt(otherUserIDStr, 10, 64)
@@ -107,17 +101,12 @@ func (h *RedisDialogHandlers) ListDialogHandler(c *gin.Context) {
 }
 
 func (h *RedisDialogHandlers) GetDialogStatsHandler(c *gin.Context) {
-	userIDStr, exists := c.Get("user_id")
+	userIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-
-	userID, err := strconv.ParseInt(userIDStr.(string), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from user_id"})
-		return
-	}
+	userID := userIDVal.(int64)
 
 	otherUserIDStr := c.Param("user_id")
 	otherUserID, err := strconv.ParseInt(otherUserIDStr, 10, 64)
@@ -139,17 +128,12 @@ func (h *RedisDialogHandlers) GetDialogStatsHandler(c *gin.Context) {
 }
 
 func (h *RedisDialogHandlers) MarkAsReadHandler(c *gin.Context) {
-	userIDStr, exists := c.Get("user_id")
+	userIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-
-	userID, err := strconv.ParseInt(userIDStr.(string), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from user_id"})
-		return
-	}
+	userID := userIDVal.(int64)
 
 	otherUserIDStr := c.Param("user_id")
 	otherUserID, err := strconv.ParseInt(otherUserIDStr, 10, 64)
@@ -1,20 +1,28 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
 	"social/db"
 	"social/models"
 	"social/services"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserInfo struct {
-	ID        int64  `json:"id"`
-	Nickname  string `json:"nickname"`
-	Firstname string `json:"first_name"`
-	Lastname  string `json:"last_name"`
+	ID        int64    `json:"id"`
+	Nickname  string   `json:"nickname"`
+	Firstname string   `json:"first_name"`
+	Lastname  string   `json:"last_name"`
+	AvatarURL string   `json:"avatar_url,omitempty"`
+	City      string   `json:"city,omitempty"`
+	Sex       string   `json:"sex,omitempty"`
+	Birthday  string   `json:"birthday,omitempty"`
+	Interests []string `json:"interests,omitempty"`
 }
 
 type UserRegisterRequest struct {
@@ -25,52 +33,125 @@ type UserRegisterRequest struct {
 	Birthday  string `json:"birthday" binding:"required"`
 	Sex       string `json:"sex" binding:"required"`
 	City      string `json:"city" binding:"required"`
+	Email     string `json:"email" binding:"omitempty,email"`
 }
 
-func UserSearch(c *gin.Context) {
-	firstName := c.Query("first_name")
-	lastName := c.Query("last_name")
+// UpdateProfileRequest - частичное обновление профиля: изменяются только переданные поля
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Birthday  *string `json:"birthday"`
+	Sex       *string `json:"sex"`
+	City      *string `json:"city"`
+}
 
-	if firstName == "" && lastName == "" {
-		c.JSON(400, gin.H{"error": "At least one search parameter (first_name or last_name) is required"})
-		return
+// parseBirthday разбирает дату рождения в формате YYYY-MM-DD
+func parseBirthday(value string) (time.Time, error) {
+	birthday, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid birthday format. Use YYYY-MM-DD")
 	}
+	return birthday, nil
+}
 
-	limit := 50
-	offset := 0
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
-			limit = l
+// viewerID возвращает ID текущего пользователя или 0 для анонимного запроса
+func viewerID(c *gin.Context) int64 {
+	if userID, exists := c.Get("user_id"); exists {
+		return userID.(int64)
+	}
+	return 0
+}
+
+// avatarURL возвращает ссылку на аватар пользователя или пустую строку
+func avatarURL(user models.User) string {
+	if user.AvatarID == "" {
+		return ""
+	}
+	return services.MediaURL(user.AvatarID)
+}
+
+// validateSex проверяет значение пола
+func validateSex(value string) error {
+	if value != string(models.MALE) && value != string(models.FEMALE) {
+		return errors.New("Sex must be 'male' or 'female'")
+	}
+	return nil
+}
+
+// UserSearch ищет пользователей по имени, фамилии, городу, полу, возрасту и интересам.
+// Пустой результат - не ошибка; следующая страница запрашивается по next_cursor
+func UserSearch(c *gin.Context) {
+	params := services.UserSearchParams{
+		FirstName:         c.Query("first_name"),
+		LastName:          c.Query("last_name"),
+		City:              c.Query("city"),
+		Sex:               models.Sex(c.Query("sex")),
+		Interests:         queryInterests(c),
+		MatchAllInterests: c.Query("match") == "all",
+		Cursor:            c.Query("cursor"),
+	}
+	if strings.TrimSpace(params.FirstName) == "" && strings.TrimSpace(params.LastName) == "" &&
+		strings.TrimSpace(params.City) == "" && params.Sex == "" && len(params.Interests) == 0 &&
+		c.Query("min_age") == "" && c.Query("max_age") == "" {
+		c.JSON(400, gin.H{"error": "At least one search parameter is required"})
+		return
+	}
+	if params.Sex != "" {
+		if err := validateSex(string(params.Sex)); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
 		}
 	}
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
+	for name, target := range map[string]*int{"min_age": &params.MinAge, "max_age": &params.MaxAge} {
+		if value := c.Query(name); value != "" {
+			age, err := strconv.Atoi(value)
+			if err != nil || age < 0 {
+				c.JSON(400, gin.H{"error": "Invalid " + name})
+				return
+			}
+			*target = age
 		}
 	}
 
-	users, err := services.SearchUsers(c.Request.Context(), firstName, lastName, limit, offset)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Internal server error"})
-		return
+	params.Limit = 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= services.MAX_SEARCH_LIMIT {
+			params.Limit = l
+		}
 	}
 
-	if len(users) == 0 {
-		c.JSON(404, gin.H{"error": "No users found"})
+	params.ViewerID = viewerID(c)
+	result, err := services.SearchUsers(c.Request.Context(), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCursor):
+			c.JSON(400, gin.H{"error": "Invalid cursor"})
+		case errors.Is(err, services.ErrInvalidInterest):
+			c.JSON(400, gin.H{"error": "Invalid interest"})
+		case errors.Is(err, services.ErrInvalidSearchParams):
+			c.JSON(400, gin.H{"error": "Invalid search parameters"})
+		default:
+			c.JSON(500, gin.H{"error": "Internal server error"})
+		}
 		return
 	}
 
-	var userInfos []UserInfo
-	for _, user := range users {
+	userInfos := []UserInfo{}
+	for _, user := range result.Users {
 		userInfos = append(userInfos, UserInfo{
 			ID:        user.ID,
 			Nickname:  user.Nickname,
 			Firstname: user.FirstName,
 			Lastname:  user.LastName,
+			AvatarURL: avatarURL(user),
 		})
 	}
 
-	c.JSON(200, gin.H{"users": userInfos})
+	response := gin.H{"users": userInfos, "total": result.Total}
+	if result.NextCursor != "" {
+		response["next_cursor"] = result.NextCursor
+	}
+	c.JSON(200, response)
 }
 
 func UserGet(c *gin.Context) {
@@ -92,11 +173,37 @@ func UserGet(c *gin.Context) {
 		return
 	}
 
+	access, err := services.GetProfileAccess(c.Request.Context(), viewerID(c), id)
+	if err != nil {
+		if errors.Is(err, services.ErrProfileHidden) {
+			c.JSON(403, gin.H{"error": "This profile is private"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
 	userInfo := UserInfo{
 		ID:        user.ID,
 		Nickname:  user.Nickname,
 		Firstname: user.FirstName,
 		Lastname:  user.LastName,
+		AvatarURL: avatarURL(*user),
+		City:      user.City,
+		Sex:       string(user.Sex),
+		Interests: []string{},
+	}
+	if access.Birthday {
+		userInfo.Birthday = user.Birthday.Format("2006-01-02")
+	}
+
+	interests, err := services.GetUserInterests(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	for _, interest := range interests {
+		userInfo.Interests = append(userInfo.Interests, interest.Name)
 	}
 
 	c.JSON(200, gin.H{"user": userInfo})
@@ -104,21 +211,27 @@ func UserGet(c *gin.Context) {
 
 func UserRegister(c *gin.Context) {
 	var req UserRegisterRequest
+	ctx := c.Request.Context()
 	if err := c.ShouldBindJSON(&req); err != nil {
+		services.RecordAuthFailure(ctx, services.AuthScopeRegister, "", c.ClientIP())
 		c.JSON(400, gin.H{"error": "Invalid request: " + err.Error()})
 		return
 	}
+	if retryAfter := services.CheckAuthAttempt(ctx, services.AuthScopeRegister, req.Nickname, c.ClientIP()); retryAfter > 0 {
+		rejectThrottled(c, retryAfter)
+		return
+	}
 
 	// Парсим дату рождения
-	birthday, err := time.Parse("2006-01-02", req.Birthday)
+	birthday, err := parseBirthday(req.Birthday)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid birthday format. Use YYYY-MM-DD"})
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Проверяем пол
-	if req.Sex != "male" && req.Sex != "female" {
-		c.JSON(400, gin.H{"error": "Sex must be 'male' or 'female'"})
+	if err := validateSex(req.Sex); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -131,6 +244,7 @@ func UserRegister(c *gin.Context) {
 		Birthday:  birthday,
 		Sex:       models.Sex(req.Sex),
 		City:      req.City,
+		Email:     req.Email,
 	}
 
 	handler := &services.UserHandler{
@@ -141,6 +255,7 @@ func UserRegister(c *gin.Context) {
 
 	userId, err := handler.Register()
 	if err != nil {
+		services.RecordAuthFailure(ctx, services.AuthScopeRegister, req.Nickname, c.ClientIP())
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
@@ -160,3 +275,138 @@ func UserRegister(c *gin.Context) {
 		"message": "User registered successfully",
 	})
 }
+
+// UpdateProfile частично обновляет профиль текущего пользователя
+func UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	// Обязательные при регистрации поля нельзя очистить
+	required := []struct {
+		field string
+		value *string
+	}{{"first_name", req.FirstName}, {"last_name", req.LastName}, {"city", req.City}}
+	for _, r := range required {
+		if r.value != nil && strings.TrimSpace(*r.value) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": r.field + " must not be empty"})
+			return
+		}
+	}
+
+	extra := &services.UserExtra{
+		Firstname: req.FirstName,
+		Lastname:  req.LastName,
+		City:      req.City,
+	}
+	if req.Birthday != nil {
+		birthday, err := parseBirthday(*req.Birthday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		extra.Birthday = &birthday
+	}
+	if req.Sex != nil {
+		if err := validateSex(*req.Sex); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		extra.Sex = req.Sex
+	}
+
+	handler := &services.UserHandler{
+		Extra:   extra,
+		DbModel: &models.User{ID: userID.(int64)},
+	}
+	user, err := handler.Update()
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type RestoreAccountRequest struct {
+	Nickname string `json:"nickname" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// DeleteAccount удаляет аккаунт текущего пользователя. Данные очищаются после срока хранения,
+// до этого аккаунт можно восстановить
+func DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	purgeAt, err := services.DeleteAccount(c.Request.Context(), userID.(int64), req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Account deleted",
+		"purge_at": purgeAt,
+	})
+}
+
+// RestoreAccount восстанавливает удаленный аккаунт до истечения срока хранения
+func RestoreAccount(c *gin.Context) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if retryAfter := services.CheckAuthAttempt(ctx, services.AuthScopeLogin, req.Nickname, c.ClientIP()); retryAfter > 0 {
+		rejectThrottled(c, retryAfter)
+		return
+	}
+
+	if err := services.RestoreAccount(ctx, req.Nickname, req.Password); err != nil {
+		if errors.Is(err, services.ErrAccountNotRestorable) {
+			services.RecordAuthFailure(ctx, services.AuthScopeLogin, req.Nickname, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials or account cannot be restored"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	services.ResetAuthFailures(ctx, services.AuthScopeLogin, req.Nickname)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored"})
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"social/api/middleware"
 	"social/services"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +13,8 @@ import (
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
+	// Клиент передает токен вторым подпротоколом, в ответе подтверждается только access_token
+	Subprotocols: []string{middleware.WSTokenProtocol},
 }
 
 // WSFeedHandler - WebSocket endpoint для ленты
@@ -28,8 +32,10 @@ func WSFeedHandler(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	services.GlobalWSConnManager.Add(userID.(int64), conn)
-	defer services.GlobalWSConnManager.Remove(userID.(int64), conn)
+	// Первое подключение делает пользователя онлайн, последнее отключение - офлайн
+	ctx := context.Background()
+	services.ConnectWS(ctx, userID.(int64), conn)
+	defer services.DisconnectWS(ctx, userID.(int64), conn)
 
 	// Тестовое приветствие
 	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"connected","message":"WebSocket connected"}`))
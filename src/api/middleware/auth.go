@@ -1,13 +1,20 @@
 package middleware
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
+// WSTokenProtocol - подпротокол WebSocket, за которым в Sec-WebSocket-Protocol следует токен.
+// Токен не передается в URL, чтобы не попадать в логи запросов
+const WSTokenProtocol = "access_token"
+
 // TestAuthMiddleware - middleware для тестовой аутентификации
 // Поддерживает два варианта:
 // 1. X-User-ID заголовок (для простых тестов)
@@ -81,3 +88,61 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// TokenResolver - функция проверки bearer-токена, возвращает ID пользователя и ID сессии
+type TokenResolver func(ctx context.Context, token string) (userID int64, sessionID string, err error)
+
+// AuthMiddleware - middleware для аутентификации по access-токенам, выданным при логине.
+// Токен передается в заголовке Authorization: Bearer <token>, для WebSocket (браузер
+// не позволяет задать заголовки) - в Sec-WebSocket-Protocol: access_token, <token>
+func AuthMiddleware(resolve TokenResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required: provide Authorization Bearer token"})
+			c.Abort()
+			return
+		}
+
+		userID, sessionID, err := resolve(c.Request.Context(), token)
+		if err != nil {
+			log.Printf("AUTH: token rejected: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Next()
+	}
+}
+
+// OptionalTokenAuthMiddleware - аутентификация по access-токену для публичных эндпоинтов:
+// при валидном токене устанавливает user_id, иначе запрос обрабатывается как анонимный
+func OptionalTokenAuthMiddleware(resolve TokenResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := bearerToken(c); token != "" {
+			if userID, sessionID, err := resolve(c.Request.Context(), token); err == nil {
+				c.Set("user_id", userID)
+				c.Set("session_id", sessionID)
+			}
+		}
+		c.Next()
+	}
+}
+
+// bearerToken извлекает токен из заголовка Authorization, а для WebSocket - из Sec-WebSocket-Protocol
+func bearerToken(c *gin.Context) string {
+	authHeader := c.GetHeader("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	if c.IsWebsocket() {
+		protocols := websocket.Subprotocols(c.Request)
+		if len(protocols) == 2 && protocols[0] == WSTokenProtocol {
+			return protocols[1]
+		}
+	}
+	return ""
+}
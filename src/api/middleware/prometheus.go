@@ -51,6 +51,22 @@ var (
 		},
 		[]string{"operation", "error_type", "service"},
 	)
+
+	authBlockedAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_blocked_attempts_total",
+			Help: "Total number of login/registration attempts rejected by brute-force protection",
+		},
+		[]string{"scope", "subject"},
+	)
+
+	authLockouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_lockouts_total",
+			Help: "Total number of temporary lockouts issued by brute-force protection",
+		},
+		[]string{"scope", "subject"},
+	)
 )
 
 func PrometheusMiddleware(serviceName string) gin.HandlerFunc {
@@ -93,3 +109,13 @@ func RecordDialogOperation(operation, status, serviceName string, duration time.
 		dialogErrors.WithLabelValues(operation, errorType, serviceName).Inc()
 	}
 }
+
+// RecordAuthBlocked учитывает попытку входа или регистрации, отклоненную защитой от перебора
+func RecordAuthBlocked(scope, subject string) {
+	authBlockedAttempts.WithLabelValues(scope, subject).Inc()
+}
+
+// RecordAuthLockout учитывает временную блокировку никнейма или IP
+func RecordAuthLockout(scope, subject string) {
+	authLockouts.WithLabelValues(scope, subject).Inc()
+}
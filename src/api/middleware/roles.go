@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"social/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleResolver - функция получения роли пользователя
+type RoleResolver func(ctx context.Context, userID int64) (models.Role, error)
+
+// RequireRole пропускает запрос, если роль пользователя включает хотя бы одну из перечисленных.
+// Должен стоять после middleware аутентификации, которое кладет user_id в контекст
+func RequireRole(resolve RoleResolver, roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		role, err := resolve(c.Request.Context(), userID.(int64))
+		if err != nil {
+			log.Printf("AUTH: failed to resolve role of user %d: %v", userID, err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		for _, required := range roles {
+			if role.Includes(required) {
+				c.Set("user_role", role)
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
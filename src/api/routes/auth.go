@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"social/api/middleware"
+	"social/config"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authMiddleware выбирает middleware аутентификации по настройке auth.mode
+func authMiddleware() gin.HandlerFunc {
+	if config.GetAuthConfig().Mode == config.AuthModeTest {
+		return middleware.TestAuthMiddleware()
+	}
+	return middleware.AuthMiddleware(services.ResolveToken)
+}
+
+// optionalAuthMiddleware определяет пользователя, если запрос аутентифицирован, не требуя аутентификации
+func optionalAuthMiddleware() gin.HandlerFunc {
+	if config.GetAuthConfig().Mode == config.AuthModeTest {
+		return middleware.OptionalAuthMiddleware()
+	}
+	return middleware.OptionalTokenAuthMiddleware(services.ResolveToken)
+}
+
+// requireRole ограничивает доступ пользователями с указанными ролями
+func requireRole(roles ...models.Role) gin.HandlerFunc {
+	return middleware.RequireRole(services.GetUserRole, roles...)
+}
@@ -2,35 +2,29 @@ package routes
 
 import (
 	"social/api/handlers"
+	"social/api/middleware"
+	"social/config"
 	"social/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func mockAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetHeader("X-User-ID")
-		if userID == "" {
-			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-		c.Set("user_id", userID)
-		c.Next()
-	}
-}
-
 func DialogInternalApi(router *gin.Engine) *gin.RouterGroup {
 	redisDialogService := services.GetRedisDialogService()
 	redisHandlers := handlers.NewRedisDialogHandlers(redisDialogService)
 
+	serviceAuth := config.GetServiceAuthConfig()
 	dialogInternalEndpoints := router.Group("/v1/")
+	dialogInternalEndpoints.Use(middleware.ServiceAuthMiddleware(serviceAuth.Secret,
+		time.Duration(serviceAuth.MaxSkew)*time.Second, services.ClaimServiceNonce))
 	{
 		dialogInternalEndpoints.POST("messages/send", handlers.SendMessageInternalHandler)
 		dialogInternalEndpoints.POST("messages/list", handlers.ListDialogInternalHandler)
 	}
 
 	dialogGroup := router.Group("/dialog")
-	dialogGroup.Use(mockAuthMiddleware())
+	dialogGroup.Use(authMiddleware())
 	{
 		dialogGroup.POST("/:user_id/send", redisHandlers.SendMessageHandler)
 		dialogGroup.GET("/:user_id/list", redisHandlers.ListDialogHandler)
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"social/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureTrustedProxies разрешает брать адрес клиента из X-Forwarded-For только у прокси
+// из backend.trusted_proxies. Без настройки c.ClientIP() возвращает адрес соединения,
+// иначе клиент мог бы подставлять любой IP и обходить ограничения по IP
+func ConfigureTrustedProxies(router *gin.Engine) error {
+	var proxies []string
+	if config.AppConfig != nil {
+		proxies = config.AppConfig.Backend.TrustedProxies
+	}
+	return router.SetTrustedProxies(proxies)
+}
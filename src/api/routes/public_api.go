@@ -2,7 +2,7 @@ package routes
 
 import (
 	"social/api/handlers"
-	"social/api/middleware"
+	"social/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,27 +12,80 @@ func PublicApi(router *gin.Engine) *gin.RouterGroup {
 	{
 		publicEndpoints.POST("auth/register", handlers.Register)
 		publicEndpoints.POST("auth/login", handlers.Login)
-		publicEndpoints.POST("auth/logout", handlers.Logout)
-		publicEndpoints.GET("user/search", handlers.UserSearch)
-		publicEndpoints.GET("user/get/:id", handlers.UserGet)
+		publicEndpoints.POST("auth/refresh", handlers.RefreshToken)
+		publicEndpoints.POST("auth/password/reset", handlers.RequestPasswordReset)
+		publicEndpoints.POST("auth/password/reset/confirm", handlers.ConfirmPasswordReset)
+		// Результат зависит от настроек приватности и того, кто спрашивает
+		publicEndpoints.GET("user/search", optionalAuthMiddleware(), handlers.UserSearch)
+		publicEndpoints.GET("user/search/interests", optionalAuthMiddleware(), handlers.UserSearchByInterests)
+		publicEndpoints.GET("user/get/:id", optionalAuthMiddleware(), handlers.UserGet)
+		publicEndpoints.GET("user/presence", optionalAuthMiddleware(), handlers.GetPresence)
+		publicEndpoints.GET("interests", handlers.ListInterests)
+		publicEndpoints.GET("media/:media_id", handlers.GetMedia)
+		publicEndpoints.GET("media/:media_id/thumbnail", handlers.GetMediaThumbnail)
 		publicEndpoints.POST("user/register", handlers.UserRegister)
+		publicEndpoints.POST("user/restore", handlers.RestoreAccount)
 
 		// Эндпоинты, требующие аутентификации
 		authenticated := publicEndpoints.Group("/")
-		authenticated.Use(middleware.TestAuthMiddleware())
+		authenticated.Use(authMiddleware())
 		{
+			// Сессии
+			authenticated.POST("auth/logout", handlers.Logout)
+			authenticated.GET("auth/sessions", handlers.ListSessions)
+			authenticated.DELETE("auth/sessions/:session_id", handlers.RevokeSession)
+			authenticated.POST("auth/sessions/revoke-others", handlers.RevokeOtherSessions)
+			authenticated.POST("auth/password/change", handlers.ChangePassword)
+
 			// WebSocket для ленты
 			authenticated.GET("ws/feed", handlers.WSFeedHandler)
 			// Друзья
 			authenticated.POST("friends/add", handlers.AddFriend)
 			authenticated.POST("friends/approve", handlers.ApproveFriend)
+			authenticated.POST("friends/reject", handlers.RejectFriend)
+			authenticated.POST("friends/cancel", handlers.CancelFriendRequest)
 			authenticated.POST("friends/delete", handlers.DeleteFriend)
 			authenticated.GET("friends/list", handlers.GetFriends)
 			authenticated.GET("friends/requests", handlers.GetPendingRequests)
+			authenticated.GET("friends/requests/outgoing", handlers.GetOutgoingRequests)
+			authenticated.GET("friends/suggestions", handlers.GetSuggestions)
+			authenticated.DELETE("friends/suggestions/:user_id", handlers.DismissSuggestion)
+			authenticated.GET("friends/mutual/:user_id", handlers.GetMutualFriends)
+			authenticated.GET("friends/degree/:user_id", handlers.GetFriendshipDegree)
+
+			// Подписки
+			authenticated.POST("follows", handlers.FollowUser)
+			authenticated.DELETE("follows/:user_id", handlers.UnfollowUser)
+			authenticated.GET("follows/:user_id/followers", handlers.ListFollowers)
+			authenticated.GET("follows/:user_id/following", handlers.ListFollowing)
+
+			// Блокировки
+			authenticated.POST("blocks", handlers.BlockUser)
+			authenticated.DELETE("blocks/:user_id", handlers.UnblockUser)
+			authenticated.GET("blocks", handlers.ListBlockedUsers)
+
+			// Профиль
+			authenticated.PATCH("user/me", handlers.UpdateProfile)
+			authenticated.DELETE("user/me", handlers.DeleteAccount)
+			authenticated.GET("user/me/interests", handlers.GetMyInterests)
+			authenticated.POST("user/me/interests", handlers.AddMyInterests)
+			authenticated.DELETE("user/me/interests/:interest_id", handlers.RemoveMyInterest)
+			authenticated.POST("user/me/export", handlers.RequestDataExport)
+			authenticated.GET("user/me/export/:export_id", handlers.GetDataExport)
+			authenticated.GET("user/me/export/:export_id/download", handlers.DownloadDataExport)
+			authenticated.GET("user/me/privacy", handlers.GetPrivacySettings)
+			authenticated.PATCH("user/me/privacy", handlers.UpdatePrivacySettings)
+			authenticated.PUT("user/me/avatar", handlers.SetAvatar)
+			authenticated.DELETE("user/me/avatar", handlers.RemoveAvatar)
+
+			// Изображения
+			authenticated.POST("media", handlers.UploadMedia)
 
 			// Посты и лента
 			authenticated.POST("posts/create", handlers.CreatePost)
+			authenticated.PUT("posts/:post_id", handlers.UpdatePost)
 			authenticated.DELETE("posts/:post_id", handlers.DeletePost)
+			authenticated.GET("posts/:post_id/revisions", handlers.GetPostRevisions)
 			authenticated.GET("feed", handlers.GetFeed)
 
 			// Диалоги
@@ -52,11 +105,18 @@ func PublicApi(router *gin.Engine) *gin.RouterGroup {
 			authenticated.POST("counters/batch", handlers.GetBatchCounters)
 		}
 
-		// Админские эндпоинты (без аутентификации для простоты)
-		publicEndpoints.DELETE("admin/cache/feed/:user_id", handlers.InvalidateUserFeed)
-		publicEndpoints.POST("admin/feed/rebuild/:user_id", handlers.RebuildUserFeed)
-		publicEndpoints.POST("admin/feed/rebuild-all", handlers.RebuildAllFeeds)
-		publicEndpoints.GET("admin/queue/stats", handlers.GetQueueStats)
+		// Админские эндпоинты, доступны модераторам и администраторам
+		admin := publicEndpoints.Group("/admin")
+		admin.Use(authMiddleware(), requireRole(models.RoleModerator))
+		{
+			admin.DELETE("cache/feed/:user_id", handlers.InvalidateUserFeed)
+			admin.POST("feed/rebuild/:user_id", handlers.RebuildUserFeed)
+			admin.GET("queue/stats", handlers.GetQueueStats)
+
+			// Только для администраторов
+			admin.POST("feed/rebuild-all", requireRole(models.RoleAdmin), handlers.RebuildAllFeeds)
+			admin.PUT("users/:user_id/role", requireRole(models.RoleAdmin), handlers.SetUserRole)
+		}
 	}
 	return publicEndpoints
 }
@@ -0,0 +1,49 @@
+// grant_role назначает роль пользователю напрямую в БД.
+// Используется для назначения первого администратора, когда через API это сделать еще некому:
+//
+//	go run ./cmd/grant_role -config config.yaml -nickname alice -role admin
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+)
+
+func main() {
+	var configPath, nickname, role string
+	var userID int64
+	flag.StringVar(&configPath, "config", "config.yaml", "Path to the configuration file")
+	flag.StringVar(&nickname, "nickname", "", "Nickname of the user")
+	flag.Int64Var(&userID, "id", 0, "ID of the user (alternative to -nickname)")
+	flag.StringVar(&role, "role", string(models.RoleAdmin), "Role to grant: user, moderator or admin")
+	flag.Parse()
+
+	if nickname == "" && userID == 0 {
+		log.Fatal("Either -nickname or -id is required")
+	}
+
+	if err := config.LoadConfig(configPath); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := db.ConnectDB(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	ctx := context.Background()
+	if userID == 0 {
+		err := db.GetWriteDB(ctx).Model(&models.User{}).Select("id").Where("nickname = ?", nickname).First(&userID).Error
+		if err != nil {
+			log.Fatalf("User %q not found: %v", nickname, err)
+		}
+	}
+
+	if err := services.SetUserRole(ctx, userID, models.Role(role)); err != nil {
+		log.Fatalf("Failed to grant role %q to user %d: %v", role, userID, err)
+	}
+	log.Printf("Role %q granted to user %d", role, userID)
+}
@@ -16,9 +16,13 @@ func setupRedisDialogRoutes(r *gin.Engine, redisService *services.RedisDialogSer
 	// Создаем обработчики для Redis диалогов
 	redisHandlers := handlers.NewRedisDialogHandlers(redisService)
 
-	// API группа с аутентификацией
+	// API группа с аутентификацией: middleware выбирается по auth.mode, как в основном сервере
 	api := r.Group("/api/v1")
-	api.Use(middleware.AuthMiddleware())
+	if config.GetAuthConfig().Mode == config.AuthModeTest {
+		api.Use(middleware.TestAuthMiddleware())
+	} else {
+		api.Use(middleware.AuthMiddleware(services.ResolveToken))
+	}
 
 	// Redis диалоги маршруты (с префиксом /redis для тестирования)
 	redisDialogs := api.Group("/redis/dialog")
@@ -54,7 +58,7 @@ func mainWithRedisDialogs() {
 	}
 
 	// Инициализируем базу данных
-	if err := db.InitDB(); err != nil {
+	if err := db.ConnectDB(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
@@ -62,13 +66,9 @@ func mainWithRedisDialogs() {
 	redisService := initializeRedisDialogService()
 	defer redisService.Close()
 
-	// Настраиваем Gin
+	// Настраиваем Gin (логирование и восстановление после паники входят в gin.Default)
 	r := gin.Default()
 
-	// Добавляем middleware
-	r.Use(middleware.CORSMiddleware())
-	r.Use(middleware.LoggingMiddleware())
-
 	// Настраиваем существующие роуты
 	setupRoutes(r)
 
@@ -21,6 +21,111 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// Режимы аутентификации публичного API
+const (
+	AuthModeToken = "token" // проверка bearer-токенов из user_tokens
+	AuthModeTest  = "test"  // X-User-ID и test_token_N, только для тестов
+)
+
+type AuthConfig struct {
+	Mode                  string `yaml:"mode"`
+	TokenCacheTTL         int    `yaml:"token_cache_ttl"` // секунды
+	AccessTokenSecret     string `yaml:"access_token_secret"`
+	AccessTokenTTL        int    `yaml:"access_token_ttl"`        // секунды
+	RefreshTokenTTL       int    `yaml:"refresh_token_ttl"`       // секунды
+	PasswordResetTTL      int    `yaml:"password_reset_ttl"`      // секунды
+	PasswordResetCooldown int    `yaml:"password_reset_cooldown"` // секунды между выпуском кодов сброса
+
+	PasswordHash PasswordHashConfig `yaml:"password_hash"`
+	BruteForce   BruteForceConfig   `yaml:"brute_force"`
+}
+
+// BruteForceConfig - пороги защиты логина и регистрации от перебора.
+// После free_attempts_* неудач каждая следующая откладывает новую попытку на
+// backoff_base * 2^(n-1) секунд, после max_failures_* субъект блокируется на lockout секунд
+type BruteForceConfig struct {
+	Disabled                bool `yaml:"disabled"`
+	Window                  int  `yaml:"window"` // секунды, за которые считаются неудачи
+	FreeAttemptsPerNickname int  `yaml:"free_attempts_per_nickname"`
+	MaxFailuresPerNickname  int  `yaml:"max_failures_per_nickname"`
+	FreeAttemptsPerIP       int  `yaml:"free_attempts_per_ip"`
+	MaxFailuresPerIP        int  `yaml:"max_failures_per_ip"`
+	BackoffBase             int  `yaml:"backoff_base"` // секунды
+	Lockout                 int  `yaml:"lockout"`      // секунды
+}
+
+// PasswordHashConfig - параметры argon2id для новых хешей паролей
+type PasswordHashConfig struct {
+	Memory      uint32 `yaml:"memory"` // КиБ
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"` // байты
+	KeyLength   uint32 `yaml:"key_length"`  // байты
+}
+
+// ServiceAuthConfig - подпись запросов между сервисами (публичный API -> сервис диалогов)
+type ServiceAuthConfig struct {
+	Secret  string `yaml:"secret"`   // общий для всех сервисов ключ HMAC
+	MaxSkew int    `yaml:"max_skew"` // допустимое расхождение времени, секунды
+}
+
+// ExportConfig - архивы выгрузки персональных данных
+type ExportConfig struct {
+	Dir string `yaml:"dir"` // каталог для zip-архивов
+	TTL int    `yaml:"ttl"` // сколько архив доступен для скачивания, секунды
+}
+
+// AccountConfig - удаление аккаунтов
+type AccountConfig struct {
+	DeletionGracePeriod int `yaml:"deletion_grace_period"` // сколько удаленный аккаунт можно восстановить, секунды
+	PurgeInterval       int `yaml:"purge_interval"`        // как часто запускается окончательное удаление, секунды
+}
+
+// FriendsConfig - заявки в друзья
+type FriendsConfig struct {
+	RejectCooldown             int `yaml:"reject_cooldown"`              // через сколько после отказа можно отправить заявку снова, секунды
+	SuggestionsTTL             int `yaml:"suggestions_ttl"`              // сколько рекомендации хранятся в Redis без запросов, секунды
+	SuggestionsRefreshInterval int `yaml:"suggestions_refresh_interval"` // как часто пересчитываются закешированные рекомендации, секунды
+	FeedBackfillPosts          int `yaml:"feed_backfill_posts"`          // сколько последних постов нового друга добавляется в закешированную ленту
+}
+
+// PresenceConfig - отслеживание онлайн-статуса по WebSocket-подключениям
+type PresenceConfig struct {
+	HeartbeatInterval int `yaml:"heartbeat_interval"` // как часто инстанс подтверждает подключенных пользователей, секунды
+	TTL               int `yaml:"ttl"`                // через сколько без подтверждения пользователь считается офлайн, секунды
+}
+
+// Хранилища загруженных изображений
+const (
+	MediaStorageLocal = "local" // файлы на локальном диске
+	MediaStorageS3    = "s3"    // S3-совместимое объектное хранилище
+)
+
+// MediaConfig - загрузка и хранение изображений (аватары, картинки постов)
+type MediaConfig struct {
+	Storage       string        `yaml:"storage"`
+	Dir           string        `yaml:"dir"`            // каталог для storage: local
+	MaxSize       int64         `yaml:"max_size"`       // максимальный размер файла, байты
+	MaxPixels     int           `yaml:"max_pixels"`     // максимальное разрешение (ширина * высота)
+	ThumbnailSize int           `yaml:"thumbnail_size"` // длинная сторона превью, пиксели
+	BaseURL       string        `yaml:"base_url"`       // префикс ссылок на файлы в ответах API
+	S3            S3StoreConfig `yaml:"s3"`
+}
+
+// S3StoreConfig - подключение к S3-совместимому хранилищу (запросы подписываются AWS Signature V4)
+type S3StoreConfig struct {
+	Endpoint  string `yaml:"endpoint"` // например http://localhost:9000; бакет указывается в пути
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+type MailConfig struct {
+	From     string `yaml:"from"`
+	SinkPath string `yaml:"sink_path"` // файл для писем; пусто - письма пишутся в лог
+}
+
 type Config struct {
 	Databases struct {
 		Master   DBConfig   `yaml:"master"`
@@ -29,8 +134,9 @@ type Config struct {
 	Redis        RedisConfig `yaml:"redis"`
 	RedisDialogs RedisConfig `yaml:"redis_dialogs"`
 	Backend      struct {
-		Host string `yaml:"host"`
-		Port int    `yaml:"port"`
+		Host           string   `yaml:"host"`
+		Port           int      `yaml:"port"`
+		TrustedProxies []string `yaml:"trusted_proxies"` // адреса и подсети прокси, которым доверяется X-Forwarded-For
 	} `yaml:"backend"`
 	RabbitMQ struct {
 		URL string `yaml:"url"`
@@ -39,8 +145,16 @@ type Config struct {
 		Level     string `yaml:"level"`
 		SentrySDK string `yaml:"sentry_sdk"`
 	} `yaml:"logs"`
-	ShardCount       int    `yaml:"shard_count"`
-	DialogServiceURL string `yaml:"dialog_service_url"`
+	Auth             AuthConfig        `yaml:"auth"`
+	Mail             MailConfig        `yaml:"mail"`
+	Export           ExportConfig      `yaml:"export"`
+	Account          AccountConfig     `yaml:"account"`
+	Media            MediaConfig       `yaml:"media"`
+	Presence         PresenceConfig    `yaml:"presence"`
+	Friends          FriendsConfig     `yaml:"friends"`
+	ServiceAuth      ServiceAuthConfig `yaml:"service_auth"`
+	ShardCount       int               `yaml:"shard_count"`
+	DialogServiceURL string            `yaml:"dialog_service_url"`
 }
 
 var AppConfig *Config
@@ -53,3 +167,187 @@ func LoadConfig(filePath string) error {
 	err = yaml.Unmarshal(data, &AppConfig)
 	return err
 }
+
+// GetAuthConfig возвращает настройки аутентификации с дефолтными значениями
+func GetAuthConfig() AuthConfig {
+	var auth AuthConfig
+	if AppConfig != nil {
+		auth = AppConfig.Auth
+	}
+	if auth.Mode == "" {
+		auth.Mode = AuthModeToken
+	}
+	if auth.TokenCacheTTL <= 0 {
+		auth.TokenCacheTTL = 300
+	}
+	if auth.AccessTokenTTL <= 0 {
+		auth.AccessTokenTTL = 15 * 60
+	}
+	if auth.RefreshTokenTTL <= 0 {
+		auth.RefreshTokenTTL = 30 * 24 * 60 * 60
+	}
+	if auth.PasswordResetTTL <= 0 {
+		auth.PasswordResetTTL = 60 * 60
+	}
+	if auth.PasswordResetCooldown <= 0 {
+		auth.PasswordResetCooldown = 15 * 60
+	}
+	if auth.PasswordHash.Memory == 0 {
+		auth.PasswordHash.Memory = 64 * 1024
+	}
+	if auth.PasswordHash.Iterations == 0 {
+		auth.PasswordHash.Iterations = 3
+	}
+	if auth.PasswordHash.Parallelism == 0 {
+		auth.PasswordHash.Parallelism = 4
+	}
+	if auth.PasswordHash.SaltLength == 0 {
+		auth.PasswordHash.SaltLength = 16
+	}
+	if auth.PasswordHash.KeyLength == 0 {
+		auth.PasswordHash.KeyLength = 32
+	}
+	bf := &auth.BruteForce
+	if bf.Window <= 0 {
+		bf.Window = 15 * 60
+	}
+	if bf.FreeAttemptsPerNickname <= 0 {
+		bf.FreeAttemptsPerNickname = 3
+	}
+	if bf.MaxFailuresPerNickname <= 0 {
+		bf.MaxFailuresPerNickname = 10
+	}
+	if bf.FreeAttemptsPerIP <= 0 {
+		bf.FreeAttemptsPerIP = 20
+	}
+	if bf.MaxFailuresPerIP <= 0 {
+		bf.MaxFailuresPerIP = 100
+	}
+	if bf.BackoffBase <= 0 {
+		bf.BackoffBase = 1
+	}
+	if bf.Lockout <= 0 {
+		bf.Lockout = 15 * 60
+	}
+	return auth
+}
+
+// GetServiceAuthConfig возвращает настройки подписи межсервисных запросов с дефолтными значениями
+func GetServiceAuthConfig() ServiceAuthConfig {
+	var serviceAuth ServiceAuthConfig
+	if AppConfig != nil {
+		serviceAuth = AppConfig.ServiceAuth
+	}
+	if serviceAuth.MaxSkew <= 0 {
+		serviceAuth.MaxSkew = 300
+	}
+	return serviceAuth
+}
+
+// GetMailConfig возвращает настройки отправки писем с дефолтными значениями
+func GetMailConfig() MailConfig {
+	var mail MailConfig
+	if AppConfig != nil {
+		mail = AppConfig.Mail
+	}
+	if mail.From == "" {
+		mail.From = "no-reply@social.local"
+	}
+	return mail
+}
+
+// GetExportConfig возвращает настройки выгрузки персональных данных с дефолтными значениями
+func GetExportConfig() ExportConfig {
+	var export ExportConfig
+	if AppConfig != nil {
+		export = AppConfig.Export
+	}
+	if export.Dir == "" {
+		export.Dir = "./exports"
+	}
+	if export.TTL <= 0 {
+		export.TTL = 7 * 24 * 60 * 60
+	}
+	return export
+}
+
+// GetAccountConfig возвращает настройки удаления аккаунтов с дефолтными значениями
+func GetAccountConfig() AccountConfig {
+	var account AccountConfig
+	if AppConfig != nil {
+		account = AppConfig.Account
+	}
+	if account.DeletionGracePeriod <= 0 {
+		account.DeletionGracePeriod = 30 * 24 * 60 * 60
+	}
+	if account.PurgeInterval <= 0 {
+		account.PurgeInterval = 60 * 60
+	}
+	return account
+}
+
+// GetFriendsConfig возвращает настройки заявок в друзья с дефолтными значениями
+func GetFriendsConfig() FriendsConfig {
+	var friends FriendsConfig
+	if AppConfig != nil {
+		friends = AppConfig.Friends
+	}
+	if friends.RejectCooldown <= 0 {
+		friends.RejectCooldown = 7 * 24 * 60 * 60
+	}
+	if friends.SuggestionsTTL <= 0 {
+		friends.SuggestionsTTL = 24 * 60 * 60
+	}
+	if friends.SuggestionsRefreshInterval <= 0 {
+		friends.SuggestionsRefreshInterval = 60 * 60
+	}
+	if friends.FeedBackfillPosts <= 0 {
+		friends.FeedBackfillPosts = 20
+	}
+	return friends
+}
+
+// GetPresenceConfig возвращает настройки онлайн-статуса с дефолтными значениями
+func GetPresenceConfig() PresenceConfig {
+	var presence PresenceConfig
+	if AppConfig != nil {
+		presence = AppConfig.Presence
+	}
+	if presence.HeartbeatInterval <= 0 {
+		presence.HeartbeatInterval = 30
+	}
+	if presence.TTL <= presence.HeartbeatInterval {
+		presence.TTL = 3 * presence.HeartbeatInterval
+	}
+	return presence
+}
+
+// GetMediaConfig возвращает настройки хранения изображений с дефолтными значениями
+func GetMediaConfig() MediaConfig {
+	var media MediaConfig
+	if AppConfig != nil {
+		media = AppConfig.Media
+	}
+	if media.Storage == "" {
+		media.Storage = MediaStorageLocal
+	}
+	if media.Dir == "" {
+		media.Dir = "./media"
+	}
+	if media.MaxSize <= 0 {
+		media.MaxSize = 10 * 1024 * 1024
+	}
+	if media.MaxPixels <= 0 {
+		media.MaxPixels = 40 * 1000 * 1000
+	}
+	if media.ThumbnailSize <= 0 {
+		media.ThumbnailSize = 320
+	}
+	if media.BaseURL == "" {
+		media.BaseURL = "/api/v1/media"
+	}
+	if media.S3.Region == "" {
+		media.S3.Region = "us-east-1"
+	}
+	return media
+}
@@ -15,6 +15,9 @@ import (
 
 var ORM *gorm.DB
 
+// trigramEnabled - расширение pg_trgm и индексы для нечеткого поиска созданы
+var trigramEnabled bool
+
 func dsnFromConfig(dbConf config.DBConfig) string {
 	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
@@ -74,13 +77,22 @@ func ConnectDB() (err error) {
 	}
 	// Автоматическая миграция схемы базы данных
 	err = db.AutoMigrate(
+		&models.DataExport{},
+		&models.Follow{},
 		&models.Friend{},
 		&models.Interest{},
+		&models.Media{},
 		&models.Message{},
 		&models.Migration{},
+		&models.PasswordReset{},
 		&models.Post{},
+		&models.PostRevision{},
+		&models.PrivacySettings{},
 		&models.ShardMap{},
+		&models.SuggestionDismissal{},
+		&models.UserBlock{},
 		&models.UserInterest{},
+		&models.UserSession{},
 		&models.UserTokens{},
 		&models.User{},
 		&models.WriteTransaction{},
@@ -102,10 +114,22 @@ func ConnectDB() (err error) {
 		return fmt.Errorf("failed to create sharded message tables: %w", err)
 	}
 
+	// Нечеткий поиск пользователей работает только с pg_trgm, без него поиск идет по префиксу
+	if err := CreateTrigramIndexes(db); err != nil {
+		log.Printf("WARNING: trigram search is disabled: %v", err)
+	} else {
+		trigramEnabled = true
+	}
+
 	ORM = db
 	return nil
 }
 
+// TrigramEnabled сообщает, доступен ли в БД нечеткий поиск через pg_trgm
+func TrigramEnabled() bool {
+	return trigramEnabled && ORM != nil && ORM.Dialector.Name() == "postgres"
+}
+
 // GetReadOnlyDB возвращает подключение для чтения (слейвы)
 func GetReadOnlyDB(ctx context.Context) *gorm.DB {
 	if ORM == nil {
@@ -47,6 +47,34 @@ func CreateShardedMessageTables(db *gorm.DB, shards int) error {
 	return nil
 }
 
+// MessageShardTables возвращает имена существующих шардированных таблиц сообщений
+func MessageShardTables(db *gorm.DB) []string {
+	var tables []string
+	for i := 0; ; i++ {
+		tableName := fmt.Sprintf("messages_%d", i)
+		if !db.Migrator().HasTable(tableName) {
+			return tables
+		}
+		tables = append(tables, tableName)
+	}
+}
+
+// CreateTrigramIndexes включает pg_trgm и создает GIN-индексы для нечеткого поиска по имени и фамилии.
+// Возвращает ошибку, если расширение недоступно (например, нет прав на CREATE EXTENSION)
+func CreateTrigramIndexes(db *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_users_first_name_trgm ON users USING gin (first_name gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_last_name_trgm ON users USING gin (last_name gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to execute %q: %w", statement, err)
+		}
+	}
+	return nil
+}
+
 // CreateSexEnum создает тип ENUM sex, если он не существует
 func CreateSexEnum(db *gorm.DB) error {
 	createEnumSQL := `
@@ -5,6 +5,7 @@ import (
 	"social/api/middleware"
 	"social/api/routes"
 	"social/config"
+	"social/db"
 	"social/services"
 
 	"github.com/gin-gonic/gin"
@@ -19,13 +20,22 @@ func main() {
 	}
 
 	router := gin.Default()
+	if err := routes.ConfigureTrustedProxies(router); err != nil {
+		panic("Invalid backend.trusted_proxies: " + err.Error())
+	}
 
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(middleware.PrometheusMiddleware("dialogs"))
 
+	// БД нужна для проверки токенов и шардированных таблиц сообщений
+	err := db.ConnectDB()
+	if err != nil {
+		panic("Failed to connect to the database: " + err.Error())
+	}
+
 	// Инициализируем Redis
-	err := services.InitRedis()
+	err = services.InitRedis()
 	if err != nil {
 		panic("Failed to connect to Redis: " + err.Error())
 	}
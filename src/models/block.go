@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserBlock - пользователь UserID заблокировал пользователя BlockedID
+type UserBlock struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64     `gorm:"index;uniqueIndex:user_block_pair_idx" json:"user_id"`
+	BlockedID int64     `gorm:"index;uniqueIndex:user_block_pair_idx" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
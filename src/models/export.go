@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Статусы выгрузки персональных данных
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+)
+
+// DataExport - задание на выгрузку персональных данных пользователя в zip-архив
+type DataExport struct {
+	ID          string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID      int64      `gorm:"index" json:"user_id"`
+	Status      string     `gorm:"size:20;not null" json:"status"`
+	FilePath    string     `gorm:"size:512" json:"-"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `gorm:"size:512" json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+func (DataExport) TableName() string {
+	return "data_exports"
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Follow - односторонняя подписка: FollowerID читает посты FolloweeID в своей ленте
+type Follow struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	FollowerID int64     `gorm:"index;uniqueIndex:follow_pair_idx" json:"follower_id"`
+	FolloweeID int64     `gorm:"index;uniqueIndex:follow_pair_idx" json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Follow) TableName() string {
+	return "follows"
+}
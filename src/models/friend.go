@@ -2,15 +2,25 @@ package models
 
 import "time"
 
-// Friend - модель для хранения дружбы между пользователями
-// Status: "pending" (ожидание), "approved" (подтверждена)
+// Статусы заявки в друзья
+const (
+	FriendStatusPending  = "pending"  // ожидает ответа
+	FriendStatusApproved = "approved" // дружба подтверждена
+	FriendStatusRejected = "rejected" // получатель отклонил заявку
+)
+
+// Friend - модель для хранения дружбы между пользователями.
+// UserID - отправитель заявки, FriendID - получатель. Составные индексы покрывают
+// выборку друзей пользователя в обе стороны (friendIDsQuery) без обращения к таблице
 type Friend struct {
 	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID     int64     `gorm:"index" json:"user_id"`
-	FriendID   int64     `gorm:"index" json:"friend_id"`
-	Status     string    `gorm:"type:varchar(20);default:pending" json:"status"`
-	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UserID     int64     `gorm:"index;index:friends_outgoing_idx,priority:1;index:friends_incoming_idx,priority:3" json:"user_id"`
+	FriendID   int64     `gorm:"index;index:friends_outgoing_idx,priority:3;index:friends_incoming_idx,priority:1" json:"friend_id"`
+	Status     string    `gorm:"type:varchar(20);default:pending;index:friends_outgoing_idx,priority:2;index:friends_incoming_idx,priority:2" json:"status"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"` // когда отправлена заявка
 	ApprovedAt time.Time `json:"approved_at,omitempty"`
+	RejectedAt time.Time `json:"rejected_at,omitempty"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"` // последнее изменение статуса
 }
 
 func (Friend) TableName() string {
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Назначение загруженного изображения
+const (
+	MediaKindAvatar = "avatar"
+	MediaKindPost   = "post"
+)
+
+// Media - метаданные загруженного изображения; сами файлы (оригинал и превью) лежат в BlobStore
+type Media struct {
+	ID           string    `gorm:"primaryKey;size:32" json:"id"`
+	UserID       int64     `gorm:"index" json:"user_id"`
+	Kind         string    `gorm:"size:16;not null" json:"kind"`
+	PostID       *int64    `gorm:"index" json:"post_id,omitempty"`
+	Position     int       `json:"-"` // порядок изображения в посте
+	ContentType  string    `gorm:"size:64;not null" json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	StorageKey   string    `gorm:"size:255;not null" json:"-"`
+	ThumbnailKey string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (Media) TableName() string {
+	return "media"
+}
+
+// FeedMedia - изображение поста в ленте
+type FeedMedia struct {
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
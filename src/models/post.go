@@ -17,12 +17,13 @@ func (Post) TableName() string {
 
 // FeedPost - структура для ленты с дополнительной информацией о пользователе
 type FeedPost struct {
-	ID         int64     `json:"id"`
-	UserID     int64     `json:"user_id"`
-	UserName   string    `json:"user_name"`
-	UserAvatar string    `json:"user_avatar,omitempty"`
-	Content    string    `json:"content"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         int64       `json:"id"`
+	UserID     int64       `json:"user_id"`
+	UserName   string      `json:"user_name"`
+	UserAvatar string      `json:"user_avatar,omitempty"`
+	Content    string      `json:"content"`
+	Media      []FeedMedia `json:"media,omitempty" gorm:"-"`
+	CreatedAt  time.Time   `json:"created_at"`
 }
 
 // FeedResponse - ответ API для ленты
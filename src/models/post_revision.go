@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PostRevision - предыдущая версия отредактированного поста. CreatedAt - когда версию заменили
+type PostRevision struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PostID    int64     `gorm:"index" json:"post_id"`
+	UserID    int64     `gorm:"index" json:"user_id"`
+	Content   string    `gorm:"type:text" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (PostRevision) TableName() string {
+	return "post_revisions"
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Кому доступно действие или часть профиля
+const (
+	PrivacyEveryone         = "everyone"
+	PrivacyFriends          = "friends"
+	PrivacyFriendsOfFriends = "friends_of_friends" // только для friend_requests
+	PrivacyNobody           = "nobody"
+)
+
+// PrivacySettings - настройки приватности пользователя. Отсутствие записи означает
+// настройки по умолчанию (все доступно всем)
+type PrivacySettings struct {
+	UserID         int64     `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Messages       string    `gorm:"size:20;not null;default:everyone" json:"messages"`        // кто может писать сообщения
+	Profile        string    `gorm:"size:20;not null;default:everyone" json:"profile"`         // кто видит город, пол, интересы и аватар
+	Birthday       string    `gorm:"size:20;not null;default:everyone" json:"birthday"`        // кто видит дату рождения и находит по возрасту
+	FriendRequests string    `gorm:"size:20;not null;default:everyone" json:"friend_requests"` // кто может отправить заявку в друзья
+	Presence       string    `gorm:"size:20;not null;default:everyone" json:"presence"`        // кто видит онлайн-статус и время последнего визита
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (PrivacySettings) TableName() string {
+	return "privacy_settings"
+}
+
+// DefaultPrivacySettings возвращает настройки пользователя, который их не менял
+func DefaultPrivacySettings(userID int64) PrivacySettings {
+	return PrivacySettings{
+		UserID:         userID,
+		Messages:       PrivacyEveryone,
+		Profile:        PrivacyEveryone,
+		Birthday:       PrivacyEveryone,
+		FriendRequests: PrivacyEveryone,
+		Presence:       PrivacyEveryone,
+	}
+}
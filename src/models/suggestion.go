@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SuggestionDismissal - пользователь UserID скрыл DismissedID из рекомендаций друзей
+type SuggestionDismissal struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int64     `gorm:"index;uniqueIndex:suggestion_dismissal_pair_idx" json:"user_id"`
+	DismissedID int64     `gorm:"uniqueIndex:suggestion_dismissal_pair_idx" json:"dismissed_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (SuggestionDismissal) TableName() string {
+	return "suggestion_dismissals"
+}
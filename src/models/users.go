@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Sex string
@@ -11,17 +13,48 @@ const (
 	FEMALE Sex = "female"
 )
 
+// Role - роль пользователя. Роли упорядочены: admin включает права moderator, moderator - права user
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// Valid проверяет, что роль известна
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Includes проверяет, что роль дает права роли required
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[required]
+}
+
 type User struct {
 	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
 	Nickname  string    `gorm:"size:60;uniqueIndex" json:"nickname"`
 	FirstName string    `gorm:"size:255" json:"first_name"`
 	LastName  string    `gorm:"size:255" json:"last_name"`
 	Password  string    `gorm:"size:255" json:"-"`
+	Email     string    `gorm:"size:255;index" json:"-"`
 	Birthday  time.Time `json:"birthday"`
 	Sex       Sex       `gorm:"type:sex" json:"sex"`
 	City      string    `gorm:"size:255" json:"city"`
+	Role      Role      `gorm:"size:20;not null;default:user" json:"role"`
+	AvatarID  string    `gorm:"size:32" json:"avatar_id,omitempty"` // ID изображения из media
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt - время удаления аккаунта; до окончательной очистки аккаунт скрыт, но его можно восстановить
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (User) TableName() string {
@@ -33,22 +66,66 @@ type Interest struct {
 	Name string `gorm:"size:60;uniqueIndex:interests_name_key" json:"name"`
 }
 
+func (Interest) TableName() string {
+	return "interest"
+}
+
 type UserInterest struct {
 	ID         int64 `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID     int64 `gorm:"index" json:"user_id"`
-	InterestID int64 `gorm:"index" json:"interest_id"`
+	UserID     int64 `gorm:"index;uniqueIndex:user_interest_pair_idx" json:"user_id"`
+	InterestID int64 `gorm:"index;uniqueIndex:user_interest_pair_idx" json:"interest_id"`
+}
+
+func (UserInterest) TableName() string {
+	return "user_interest"
 }
 
+// UserTokens - refresh-токены пользователя.
+// Token хранит sha256 от токена, FamilyID объединяет цепочку ротаций одного входа
 type UserTokens struct {
-	ID     int64  `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID int64  `gorm:"index:user_token_idx,unique" json:"user_id"`
-	Token  string `gorm:"size:255;index:user_token_idx,unique" json:"token"`
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64      `gorm:"index:user_token_idx,unique" json:"user_id"`
+	Token     string     `gorm:"size:255;index:user_token_idx,unique;index:user_tokens_token_idx" json:"-"`
+	FamilyID  string     `gorm:"size:64;index" json:"family_id"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 func (UserTokens) TableName() string {
 	return "user_tokens"
 }
 
+// UserSession - сессия (вход с одного устройства). ID совпадает с FamilyID токенов этого входа
+type UserSession struct {
+	ID         string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID     int64      `gorm:"index" json:"user_id"`
+	DeviceName string     `gorm:"size:255" json:"device_name"`
+	UserAgent  string     `gorm:"size:512" json:"user_agent"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// PasswordReset - одноразовый код сброса пароля, в БД хранится только sha256 от кода
+type PasswordReset struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64      `gorm:"index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (PasswordReset) TableName() string {
+	return "password_resets"
+}
+
 // WriteTransaction для отслеживания записей во время нагрузочного тестирования
 type WriteTransaction struct {
 	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
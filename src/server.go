@@ -10,6 +10,7 @@ import (
 	"social/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -39,6 +40,14 @@ func main() {
 		log.Fatalf("Failed to init RedisDialogService: %v", err)
 	}
 
+	// Инициализируем отправку писем
+	services.InitMailer()
+
+	// Инициализируем хранилище изображений
+	if err := services.InitBlobStore(); err != nil {
+		log.Fatalf("Failed to init media storage: %v", err)
+	}
+
 	// Инициализируем сервис очередей
 	services.InitQueueService()
 
@@ -57,12 +66,31 @@ func main() {
 		log.Println("Queue workers started")
 	}
 
+	// Перезапускаем незавершенные выгрузки персональных данных
+	services.InitDataExports(ctx)
+
+	// Запускаем окончательную очистку удаленных аккаунтов
+	services.StartAccountPurgeWorker(ctx)
+
+	// Запускаем отслеживание онлайн-статуса
+	services.StartPresence(ctx)
+
+	// Запускаем доставку событий дружбы
+	services.StartFriendshipEvents(ctx)
+
+	// Запускаем фоновый пересчет рекомендаций друзей
+	services.StartSuggestionsRefresher(ctx)
+
 	router := gin.Default()
+	if err := routes.ConfigureTrustedProxies(router); err != nil {
+		panic("Invalid backend.trusted_proxies: " + err.Error())
+	}
 
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
 	routes.PublicApi(router)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Start the server
 	if err := router.Run(":8080"); err != nil {
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"social/config"
+	"social/db"
+	"social/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAccountNotRestorable = errors.New("account cannot be restored")
+
+// accountGracePeriod возвращает, сколько удаленный аккаунт хранится до окончательной очистки
+func accountGracePeriod() time.Duration {
+	return time.Duration(config.GetAccountConfig().DeletionGracePeriod) * time.Second
+}
+
+// DeleteAccount помечает аккаунт удаленным после проверки пароля и завершает все его сессии.
+// До окончательной очистки аккаунт скрыт из поиска, лент и списков друзей, но его можно восстановить.
+// Возвращает время, после которого данные будут удалены
+func DeleteAccount(ctx context.Context, userID int64, password string) (time.Time, error) {
+	var user models.User
+	if err := db.GetWriteDB(ctx).Select("id", "password").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, err
+	}
+	ok, _, err := verifyPassword(password, user.Password)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, ErrInvalidPassword
+	}
+
+	now := time.Now()
+	if err := db.GetWriteDB(ctx).Model(&models.User{}).Where("id = ?", userID).Update("deleted_at", now).Error; err != nil {
+		return time.Time{}, fmt.Errorf("failed to delete account: %w", err)
+	}
+	if _, err := RevokeOtherSessions(ctx, userID, ""); err != nil {
+		log.Printf("ACCOUNT: failed to revoke sessions of deleted user %d: %v", userID, err)
+	}
+	// Ленты друзей перестроятся из БД уже без постов удаленного пользователя
+	invalidateFriendFeeds(ctx, userID)
+
+	log.Printf("ACCOUNT: user %d deleted, purge scheduled", userID)
+	return now.Add(accountGracePeriod()), nil
+}
+
+// RestoreAccount отменяет удаление аккаунта, если срок хранения еще не истек
+func RestoreAccount(ctx context.Context, nickname, password string) error {
+	var user models.User
+	err := db.GetWriteDB(ctx).Unscoped().
+		Where("nickname = ? AND deleted_at IS NOT NULL AND deleted_at > ?", nickname, time.Now().Add(-accountGracePeriod())).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccountNotRestorable
+	}
+	if err != nil {
+		return err
+	}
+	ok, _, err := verifyPassword(password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAccountNotRestorable
+	}
+
+	if err := db.GetWriteDB(ctx).Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Update("deleted_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+	invalidateFriendFeeds(ctx, user.ID)
+
+	log.Printf("ACCOUNT: user %d restored", user.ID)
+	return nil
+}
+
+// StartAccountPurgeWorker периодически окончательно удаляет аккаунты с истекшим сроком хранения
+func StartAccountPurgeWorker(ctx context.Context) {
+	interval := time.Duration(config.GetAccountConfig().PurgeInterval) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			PurgeDeletedAccounts(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// PurgeDeletedAccounts очищает все аккаунты, удаленные раньше срока хранения, и возвращает их количество
+func PurgeDeletedAccounts(ctx context.Context) int {
+	var userIDs []int64
+	err := db.GetWriteDB(ctx).Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", time.Now().Add(-accountGracePeriod())).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		log.Printf("ACCOUNT: failed to load accounts to purge: %v", err)
+		return 0
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		if err := PurgeAccount(ctx, userID); err != nil {
+			log.Printf("ACCOUNT: failed to purge user %d: %v", userID, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("ACCOUNT: purged %d deleted accounts", purged)
+	}
+	return purged
+}
+
+// PurgeAccount окончательно удаляет данные пользователя из всех таблиц, шардов сообщений и Redis
+func PurgeAccount(ctx context.Context, userID int64) error {
+	writeDB := db.GetWriteDB(ctx)
+
+	var postIDs []int64
+	if err := writeDB.Model(&models.Post{}).Where("user_id = ?", userID).Pluck("id", &postIDs).Error; err != nil {
+		return err
+	}
+	var friendships []models.Friend
+	if err := writeDB.Where("user_id = ? OR friend_id = ?", userID, userID).Find(&friendships).Error; err != nil {
+		return err
+	}
+	followers, err := followerIDs(ctx, writeDB, userID)
+	if err != nil {
+		return err
+	}
+	var exports []models.DataExport
+	if err := writeDB.Where("user_id = ?", userID).Find(&exports).Error; err != nil {
+		return err
+	}
+	var media []models.Media
+	if err := writeDB.Where("user_id = ?", userID).Find(&media).Error; err != nil {
+		return err
+	}
+
+	err = writeDB.Transaction(func(tx *gorm.DB) error {
+		byUser := []interface{}{
+			&models.Post{},
+			&models.PostRevision{},
+			&models.UserTokens{},
+			&models.UserSession{},
+			&models.PasswordReset{},
+			&models.UserInterest{},
+			&models.ShardMap{},
+			&models.DataExport{},
+			&models.Media{},
+			&models.PrivacySettings{},
+		}
+		for _, model := range byUser {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ? OR friend_id = ?", userID, userID).Delete(&models.Friend{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR blocked_id = ?", userID, userID).Delete(&models.UserBlock{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR dismissed_id = ?", userID, userID).Delete(&models.SuggestionDismissal{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR followee_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		for _, table := range messageTables(tx) {
+			if err := tx.Table(table).Where("from_user_id = ? OR to_user_id = ?", userID, userID).
+				Delete(&models.Message{}).Error; err != nil {
+				return fmt.Errorf("table %s: %w", table, err)
+			}
+		}
+		return tx.Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("ACCOUNT: failed to remove export %s: %v", export.FilePath, err)
+			}
+		}
+	}
+
+	deleteMediaFiles(ctx, media)
+
+	friendIDs := make([]int64, 0, len(friendships))
+	for _, f := range friendships {
+		if f.UserID == userID {
+			friendIDs = append(friendIDs, f.FriendID)
+		} else {
+			friendIDs = append(friendIDs, f.UserID)
+		}
+	}
+	purgeAccountCache(ctx, userID, postIDs, mergeIDs(friendIDs, followers))
+
+	log.Printf("ACCOUNT: user %d purged (%d posts, %d friendships, %d media)", userID, len(postIDs), len(friendships), len(media))
+	return nil
+}
+
+// purgeAccountCache удаляет из Redis ленту, посты, диалоги, счетчики, настройки приватности,
+// онлайн-статус и рекомендации друзей пользователя
+func purgeAccountCache(ctx context.Context, userID int64, postIDs, friendIDs []int64) {
+	if RedisClient == nil {
+		return
+	}
+
+	keys := []string{
+		fmt.Sprintf("%s%d", FEED_KEY_PREFIX, userID),
+		fmt.Sprintf("%s%d", PRIVACY_KEY_PREFIX, userID),
+		fmt.Sprintf("%s%d", PRESENCE_KEY_PREFIX, userID),
+		fmt.Sprintf("%s%d", LAST_SEEN_KEY_PREFIX, userID),
+		fmt.Sprintf("%s%d", SUGGESTIONS_KEY_PREFIX, userID),
+	}
+	for counterType := range ValidTypes {
+		keys = append(keys, fmt.Sprintf("counter:%d:%s", userID, counterType))
+	}
+	postMembers := make([]interface{}, len(postIDs))
+	for i, postID := range postIDs {
+		keys = append(keys, fmt.Sprintf("%s%d", POST_KEY_PREFIX, postID))
+		postMembers[i] = strconv.FormatInt(postID, 10)
+	}
+
+	// Для каждого диалога dialog:<a>:<b> удаляем также unread:<a>:<b> и stats:<a>:<b>
+	dialogKeys, err := userDialogKeys(ctx, userID)
+	if err != nil {
+		log.Printf("ACCOUNT: failed to find dialogs of user %d: %v", userID, err)
+	}
+	for _, key := range dialogKeys {
+		pair := strings.TrimPrefix(key, "dialog:")
+		keys = append(keys, key, "unread:"+pair, "stats:"+pair)
+	}
+
+	pipe := RedisClient.Pipeline()
+	pipe.Del(ctx, keys...)
+	pipe.ZRem(ctx, SUGGESTIONS_REFRESH_KEY, strconv.FormatInt(userID, 10))
+	if len(postMembers) > 0 {
+		for _, friendID := range friendIDs {
+			pipe.ZRem(ctx, fmt.Sprintf("%s%d", FEED_KEY_PREFIX, friendID), postMembers...)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("ACCOUNT: failed to purge cache of user %d: %v", userID, err)
+	}
+}
+
+// invalidateFriendFeeds сбрасывает кеш лент друзей и подписчиков пользователя
+func invalidateFriendFeeds(ctx context.Context, userID int64) {
+	if RedisClient == nil {
+		return
+	}
+	var friendships []models.Friend
+	err := db.GetWriteDB(ctx).
+		Where("(user_id = ? OR friend_id = ?) AND status = ?", userID, userID, "approved").
+		Find(&friendships).Error
+	if err != nil {
+		log.Printf("ACCOUNT: failed to get friends of user %d: %v", userID, err)
+		return
+	}
+	followers, err := followerIDs(ctx, db.GetWriteDB(ctx), userID)
+	if err != nil {
+		log.Printf("ACCOUNT: failed to get followers of user %d: %v", userID, err)
+		return
+	}
+
+	readerIDs := make([]int64, 0, len(friendships))
+	for _, f := range friendships {
+		friendID := f.UserID
+		if friendID == userID {
+			friendID = f.FriendID
+		}
+		readerIDs = append(readerIDs, friendID)
+	}
+	readerIDs = mergeIDs(readerIDs, followers)
+	if len(readerIDs) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(readerIDs))
+	for _, readerID := range readerIDs {
+		keys = append(keys, fmt.Sprintf("%s%d", FEED_KEY_PREFIX, readerID))
+	}
+	if err := RedisClient.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("ACCOUNT: failed to invalidate friend feeds of user %d: %v", userID, err)
+	}
+}
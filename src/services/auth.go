@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"social/config"
+	"social/db"
+	"social/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AUTH_SESSION_KEY_PREFIX = "auth_session:" // Префикс для кеша активных сессий в Redis
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// tokenCacheTTL возвращает время жизни записи о сессии в кеше
+func tokenCacheTTL() time.Duration {
+	return time.Duration(config.GetAuthConfig().TokenCacheTTL) * time.Second
+}
+
+// ResolveToken проверяет access-токен и возвращает ID пользователя и ID сессии.
+// Подпись и срок действия проверяются локально, а то, что сессия не отозвана -
+// по Redis, затем по user_tokens (реплика, потом мастер на случай лага репликации)
+func ResolveToken(ctx context.Context, token string) (int64, string, error) {
+	claims, err := parseAccessToken(token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	active, err := isSessionActive(ctx, claims.UserID, claims.SessionID)
+	if err != nil {
+		return 0, "", err
+	}
+	if !active {
+		return 0, "", ErrInvalidToken
+	}
+	return claims.UserID, claims.SessionID, nil
+}
+
+// isSessionActive проверяет, что у цепочки токенов есть неотозванный и неистекший refresh-токен
+func isSessionActive(ctx context.Context, userID int64, sessionID string) (bool, error) {
+	cacheKey := AUTH_SESSION_KEY_PREFIX + sessionID
+	if RedisClient != nil {
+		if val, err := RedisClient.Get(ctx, cacheKey).Result(); err == nil {
+			cachedUserID, err := strconv.ParseInt(val, 10, 64)
+			return err == nil && cachedUserID == userID, nil
+		}
+	}
+
+	count, err := countActiveTokens(db.GetReadOnlyDB(ctx), userID, sessionID)
+	if err == nil && count == 0 {
+		count, err = countActiveTokens(db.GetWriteDB(ctx), userID, sessionID)
+	}
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	// last_used_at обновляется не на каждый запрос, а при промахе кеша (не чаще token_cache_ttl)
+	if err := touchSession(db.GetWriteDB(ctx), sessionID); err != nil {
+		log.Printf("AUTH: failed to update last_used_at for session %s: %v", sessionID, err)
+	}
+	cacheSession(ctx, sessionID, userID)
+	return true, nil
+}
+
+func countActiveTokens(tx *gorm.DB, userID int64, sessionID string) (int64, error) {
+	var count int64
+	err := tx.Model(&models.UserTokens{}).
+		Where("family_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// cacheSession сохраняет активную сессию в Redis
+func cacheSession(ctx context.Context, sessionID string, userID int64) {
+	if RedisClient == nil {
+		return
+	}
+	if err := RedisClient.Set(ctx, AUTH_SESSION_KEY_PREFIX+sessionID, userID, tokenCacheTTL()).Err(); err != nil {
+		log.Printf("AUTH: failed to cache session for user %d: %v", userID, err)
+	}
+}
+
+// invalidateSessions удаляет сессии из кеша, чтобы отозванные токены перестали работать сразу
+func invalidateSessions(ctx context.Context, sessionIDs []string) {
+	if RedisClient == nil || len(sessionIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		keys[i] = AUTH_SESSION_KEY_PREFIX + sessionID
+	}
+	if err := RedisClient.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("AUTH: failed to invalidate cached sessions: %v", err)
+	}
+}
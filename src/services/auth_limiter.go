@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"log"
+	"social/api/middleware"
+	"social/config"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Области действия защиты от перебора
+const (
+	AuthScopeLogin    = "login"
+	AuthScopeRegister = "register"
+
+	AUTH_LIMIT_KEY_PREFIX = "auth_limit:" // Префикс для счетчиков неудач и блокировок в Redis
+)
+
+// incrWithTTLScript увеличивает счетчик и ставит TTL только при создании ключа,
+// чтобы окно подсчета неудач не продлевалось каждой новой попыткой
+var incrWithTTLScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// authSubject - то, по чему считаются неудачи: никнейм или IP клиента
+type authSubject struct {
+	kind         string
+	value        string
+	freeAttempts int
+	maxFailures  int
+}
+
+func authSubjects(nickname, ip string) []authSubject {
+	conf := config.GetAuthConfig().BruteForce
+	var subjects []authSubject
+	if nickname != "" {
+		subjects = append(subjects, authSubject{"nickname", nickname, conf.FreeAttemptsPerNickname, conf.MaxFailuresPerNickname})
+	}
+	if ip != "" {
+		subjects = append(subjects, authSubject{"ip", ip, conf.FreeAttemptsPerIP, conf.MaxFailuresPerIP})
+	}
+	return subjects
+}
+
+func authFailuresKey(scope string, subject authSubject) string {
+	return AUTH_LIMIT_KEY_PREFIX + scope + ":failures:" + subject.kind + ":" + subject.value
+}
+
+func authLockKey(scope string, subject authSubject) string {
+	return AUTH_LIMIT_KEY_PREFIX + scope + ":lock:" + subject.kind + ":" + subject.value
+}
+
+// authLimiterEnabled - без Redis защита от перебора отключается
+func authLimiterEnabled() bool {
+	return RedisClient != nil && !config.GetAuthConfig().BruteForce.Disabled
+}
+
+// authBackoff возвращает, на сколько откладывается следующая попытка после n-й неудачи
+func authBackoff(n int, subject authSubject, conf config.BruteForceConfig) time.Duration {
+	lockout := time.Duration(conf.Lockout) * time.Second
+	if n >= subject.maxFailures {
+		return lockout
+	}
+	if n <= subject.freeAttempts {
+		return 0
+	}
+	shift := n - subject.freeAttempts - 1
+	if shift > 30 {
+		return lockout
+	}
+	delay := time.Duration(conf.BackoffBase) * time.Second << shift
+	if delay > lockout {
+		return lockout
+	}
+	return delay
+}
+
+// CheckAuthAttempt проверяет, разрешена ли сейчас попытка входа или регистрации.
+// Возвращает время, через которое можно повторить попытку, или 0.
+// Ошибки Redis не блокируют пользователей, а только пишутся в лог
+func CheckAuthAttempt(ctx context.Context, scope, nickname, ip string) time.Duration {
+	if !authLimiterEnabled() {
+		return 0
+	}
+
+	var retryAfter time.Duration
+	for _, subject := range authSubjects(nickname, ip) {
+		ttl, err := RedisClient.PTTL(ctx, authLockKey(scope, subject)).Result()
+		if err != nil {
+			log.Printf("AUTH LIMIT: failed to check lock for %s %s: %v", subject.kind, subject.value, err)
+			continue
+		}
+		if ttl > 0 {
+			middleware.RecordAuthBlocked(scope, subject.kind)
+			if ttl > retryAfter {
+				retryAfter = ttl
+			}
+		}
+	}
+	return retryAfter
+}
+
+// RecordAuthFailure учитывает неудачную попытку по никнейму и IP и при превышении
+// порогов откладывает следующую попытку (экспоненциально) или блокирует субъект
+func RecordAuthFailure(ctx context.Context, scope, nickname, ip string) {
+	if !authLimiterEnabled() {
+		return
+	}
+
+	conf := config.GetAuthConfig().BruteForce
+	for _, subject := range authSubjects(nickname, ip) {
+		n, err := incrWithTTLScript.Run(ctx, RedisClient, []string{authFailuresKey(scope, subject)}, conf.Window).Int()
+		if err != nil {
+			log.Printf("AUTH LIMIT: failed to count failure for %s %s: %v", subject.kind, subject.value, err)
+			continue
+		}
+
+		delay := authBackoff(n, subject, conf)
+		if delay <= 0 {
+			continue
+		}
+		if err := RedisClient.Set(ctx, authLockKey(scope, subject), n, delay).Err(); err != nil {
+			log.Printf("AUTH LIMIT: failed to lock %s %s: %v", subject.kind, subject.value, err)
+			continue
+		}
+		if n >= subject.maxFailures {
+			middleware.RecordAuthLockout(scope, subject.kind)
+			log.Printf("AUTH LIMIT: %s %s locked for %v after %d failed %s attempts", subject.kind, subject.value, delay, n, scope)
+		}
+	}
+}
+
+// ResetAuthFailures сбрасывает счетчик неудач по никнейму после успешного входа.
+// Счетчик по IP не сбрасывается, чтобы успешный вход в свой аккаунт не открывал перебор чужих
+func ResetAuthFailures(ctx context.Context, scope, nickname string) {
+	if !authLimiterEnabled() || nickname == "" {
+		return
+	}
+	subjects := authSubjects(nickname, "")
+	if err := RedisClient.Del(ctx, authFailuresKey(scope, subjects[0]), authLockKey(scope, subjects[0])).Err(); err != nil {
+		log.Printf("AUTH LIMIT: failed to reset failures for nickname %s: %v", nickname, err)
+	}
+}
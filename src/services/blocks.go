@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"social/db"
+	"social/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCannotBlockSelf = errors.New("cannot block yourself")
+	ErrUserBlocked     = errors.New("user is blocked")
+	ErrBlockNotFound   = errors.New("user is not blocked")
+)
+
+// BlockedUser - заблокированный пользователь в списке блокировок
+type BlockedUser struct {
+	ID        int64     `json:"id"`
+	Nickname  string    `json:"nickname"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockUser блокирует пользователя: удаляет дружбу, заявки и подписки между пользователями
+// и убирает посты друг друга из закешированных лент. Повторная блокировка не считается ошибкой
+func BlockUser(ctx context.Context, userID, blockedID int64) error {
+	if userID == blockedID {
+		return ErrCannotBlockSelf
+	}
+	writeDB := db.GetWriteDB(ctx)
+	var count int64
+	if err := writeDB.Model(&models.User{}).Where("id = ?", blockedID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+
+	block := &models.UserBlock{UserID: userID, BlockedID: blockedID, CreatedAt: time.Now()}
+	if err := writeDB.Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error; err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	if err := NewFriendService().DeleteFriend(userID, blockedID); err != nil {
+		return err
+	}
+	err := writeDB.Where("(follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)",
+		userID, blockedID, blockedID, userID).Delete(&models.Follow{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove follows: %w", err)
+	}
+
+	removeAuthorFromFeed(ctx, userID, blockedID)
+	removeAuthorFromFeed(ctx, blockedID, userID)
+	log.Printf("BLOCKS: user %d blocked user %d", userID, blockedID)
+	return nil
+}
+
+// UnblockUser снимает блокировку. Дружба при этом не восстанавливается
+func UnblockUser(ctx context.Context, userID, blockedID int64) error {
+	result := db.GetWriteDB(ctx).Where("user_id = ? AND blocked_id = ?", userID, blockedID).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// ListBlockedUsers возвращает пользователей, заблокированных userID, начиная с последних
+func ListBlockedUsers(ctx context.Context, userID int64) ([]BlockedUser, error) {
+	blocked := []BlockedUser{}
+	err := db.GetReadOnlyDB(ctx).
+		Table(models.UserBlock{}.TableName()+" b").
+		Select("u.id, u.nickname, u.first_name, u.last_name, b.created_at AS blocked_at").
+		Joins("JOIN users u ON u.id = b.blocked_id AND u.deleted_at IS NULL").
+		Where("b.user_id = ?", userID).
+		Order("b.created_at DESC, b.id DESC").
+		Scan(&blocked).Error
+	return blocked, err
+}
+
+// IsBlocked проверяет, заблокировал ли кто-то из пользователей другого.
+// Читает мастер, чтобы блокировка действовала сразу
+func IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	var count int64
+	err := db.GetWriteDB(ctx).Model(&models.UserBlock{}).
+		Where("(user_id = ? AND blocked_id = ?) OR (user_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// checkNotBlocked возвращает ErrUserBlocked, если пользователи блокируют друг друга
+func checkNotBlocked(ctx context.Context, userID, otherID int64) error {
+	blocked, err := IsBlocked(ctx, userID, otherID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+// sendWSFrom отправляет WebSocket-событие, вызванное действием senderID, если получатель
+// и отправитель не блокируют друг друга
+func sendWSFrom(ctx context.Context, senderID, recipientID int64, data []byte) {
+	// Без подключений к этому инстансу отправлять нечего - блокировку не проверяем
+	if !GlobalWSConnManager.IsOnline(recipientID) {
+		return
+	}
+	if senderID != recipientID {
+		blocked, err := IsBlocked(ctx, senderID, recipientID)
+		if err != nil {
+			log.Printf("BLOCKS: failed to check block between %d and %d: %v", senderID, recipientID, err)
+		}
+		if blocked {
+			return
+		}
+	}
+	GlobalWSConnManager.Send(recipientID, data)
+}
+
+// whereNotBlockedBy скрывает из выборки по users u тех, кто заблокировал viewerID
+func whereNotBlockedBy(query *gorm.DB, viewerID int64) *gorm.DB {
+	if viewerID == 0 {
+		return query
+	}
+	return query.Where("u.id NOT IN (?)", query.Session(&gorm.Session{NewDB: true}).
+		Model(&models.UserBlock{}).Select("user_id").Where("blocked_id = ?", viewerID))
+}
+
+// removeAuthorFromFeed убирает посты authorID из закешированной ленты пользователя feedOwnerID
+func removeAuthorFromFeed(ctx context.Context, feedOwnerID, authorID int64) {
+	if RedisClient == nil {
+		return
+	}
+	var postIDs []int64
+	err := db.GetWriteDB(ctx).Model(&models.Post{}).
+		Where("user_id = ?", authorID).
+		Order("id DESC").
+		Limit(MAX_FEED_SIZE).
+		Pluck("id", &postIDs).Error
+	if err != nil {
+		log.Printf("BLOCKS: failed to get posts of user %d: %v", authorID, err)
+		return
+	}
+	if len(postIDs) == 0 {
+		return
+	}
+	members := make([]interface{}, len(postIDs))
+	for i, postID := range postIDs {
+		members[i] = strconv.FormatInt(postID, 10)
+	}
+	feedKey := fmt.Sprintf("%s%d", FEED_KEY_PREFIX, feedOwnerID)
+	if err := RedisClient.ZRem(ctx, feedKey, members...).Err(); err != nil {
+		log.Printf("BLOCKS: failed to remove posts of user %d from feed of user %d: %v", authorID, feedOwnerID, err)
+	}
+}
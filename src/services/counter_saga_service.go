@@ -271,6 +271,44 @@ func (s *CounterSagaService) HandleMarkAsRead(userID, dialogPartnerID int64) err
 	return saga.Execute()
 }
 
+// HandleFriendshipChange применяет изменение дружбы с использованием SAGA: сначала атомарно меняет
+// счетчик friend_requests пользователя userID на delta, затем выполняет apply; если apply
+// завершился ошибкой, изменение счетчика компенсируется
+func (s *CounterSagaService) HandleFriendshipChange(userID, delta int64, apply func(ctx context.Context) error) error {
+	sagaID := fmt.Sprintf("friendship_%d_%d", userID, time.Now().UnixNano())
+	saga := s.NewSaga(sagaID)
+	defer func() {
+		s.mu.Lock()
+		delete(s.activeSagas, sagaID)
+		s.mu.Unlock()
+	}()
+
+	var counterCompensation *SagaCompensation
+
+	// Шаг 1: Обновляем счетчик заявок в друзья
+	saga.AddStep(
+		"update_friend_requests_counter",
+		func(ctx context.Context) error {
+			err := s.counterService.IncrementCounterSync(userID, CounterTypeFriendRequests, delta)
+			if err == nil {
+				counterCompensation = s.counterService.CreateCompensation(userID, CounterTypeFriendRequests, delta)
+			}
+			return err
+		},
+		func(ctx context.Context) error {
+			if counterCompensation != nil {
+				return s.counterService.ExecuteCompensation(counterCompensation)
+			}
+			return nil
+		},
+	)
+
+	// Шаг 2: Сохраняем изменение дружбы в базе данных
+	saga.AddStep("save_friendship", apply, nil)
+
+	return saga.Execute()
+}
+
 // ReconcileCounter сверяет счетчик с реальными данными и исправляет расхождения
 func (s *CounterSagaService) ReconcileCounter(userID int64, counterType CounterType) error {
 	var actualCount int64
@@ -290,9 +328,9 @@ func (s *CounterSagaService) ReconcileCounter(userID int64, counterType CounterT
 			Scan(&actualCount).Error
 
 	case CounterTypeFriendRequests:
-		// Подсчитываем количество запросов в друзья
+		// Подсчитываем входящие заявки: получатель заявки хранится в friend_id
 		err = db.GetWriteDB(s.ctx).Model(&models.Friend{}).
-			Where("user_id = ? AND status = ?", userID, "pending").
+			Where("friend_id = ? AND status = ?", userID, models.FriendStatusPending).
 			Count(&actualCount).Error
 
 	default:
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"social/config"
+	"social/db"
+	"social/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready")
+	ErrExportExpired  = errors.New("export has expired")
+)
+
+// EXPORT_CLEANUP_INTERVAL - как часто удаляются архивы с истекшим сроком хранения
+const EXPORT_CLEANUP_INTERVAL = time.Hour
+
+// exportedProfile - профиль пользователя в выгрузке, включая скрытые в API поля
+type exportedProfile struct {
+	models.User
+	Email string `json:"email,omitempty"`
+}
+
+// exportedMedia - метаданные загруженного изображения со ссылкой на файл
+type exportedMedia struct {
+	models.Media
+	URL string `json:"url"`
+}
+
+// exportedMessage - сообщение в выгрузке с указанием хранилища, из которого оно взято
+type exportedMessage struct {
+	Source    string    `json:"source"` // таблица БД или ключ Redis
+	ID        string    `json:"id"`
+	FromID    int64     `json:"from_id"`
+	ToID      int64     `json:"to_id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	IsRead    bool      `json:"is_read"`
+}
+
+// RequestDataExport ставит в очередь выгрузку персональных данных пользователя.
+// Если у пользователя уже есть незавершенная выгрузка, возвращается она
+func RequestDataExport(ctx context.Context, userID int64) (*models.DataExport, error) {
+	var active models.DataExport
+	err := db.GetWriteDB(ctx).
+		Where("user_id = ? AND status IN ?", userID, []string{models.ExportStatusPending, models.ExportStatusProcessing}).
+		First(&active).Error
+	if err == nil {
+		return &active, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	export := &models.DataExport{
+		ID:        id,
+		UserID:    userID,
+		Status:    models.ExportStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if err := db.GetWriteDB(ctx).Create(export).Error; err != nil {
+		return nil, err
+	}
+
+	go runDataExport(export.ID)
+	return export, nil
+}
+
+// GetDataExport возвращает выгрузку пользователя (из мастера, чтобы статус был актуальным)
+func GetDataExport(ctx context.Context, userID int64, exportID string) (*models.DataExport, error) {
+	var export models.DataExport
+	err := db.GetWriteDB(ctx).Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetDataExportFile возвращает путь к готовому архиву выгрузки
+func GetDataExportFile(ctx context.Context, userID int64, exportID string) (string, error) {
+	export, err := GetDataExport(ctx, userID, exportID)
+	if err != nil {
+		return "", err
+	}
+	if export.Status != models.ExportStatusReady {
+		return "", ErrExportNotReady
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		return "", ErrExportExpired
+	}
+	if _, err := os.Stat(export.FilePath); err != nil {
+		return "", ErrExportExpired
+	}
+	return export.FilePath, nil
+}
+
+// InitDataExports перезапускает выгрузки, прерванные остановкой сервера,
+// и запускает периодическое удаление устаревших архивов
+func InitDataExports(ctx context.Context) {
+	var ids []string
+	err := db.GetWriteDB(ctx).Model(&models.DataExport{}).
+		Where("status IN ?", []string{models.ExportStatusPending, models.ExportStatusProcessing}).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("EXPORT: failed to load unfinished exports: %v", err)
+	}
+	for _, id := range ids {
+		go runDataExport(id)
+	}
+
+	go func() {
+		ticker := time.NewTicker(EXPORT_CLEANUP_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				CleanupDataExports(ctx)
+			}
+		}
+	}()
+}
+
+// CleanupDataExports удаляет архивы и записи выгрузок с истекшим сроком хранения
+func CleanupDataExports(ctx context.Context) {
+	var expired []models.DataExport
+	if err := db.GetWriteDB(ctx).Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		log.Printf("EXPORT: failed to load expired exports: %v", err)
+		return
+	}
+	for _, export := range expired {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("EXPORT: failed to remove %s: %v", export.FilePath, err)
+				continue
+			}
+		}
+		db.GetWriteDB(ctx).Delete(&models.DataExport{}, "id = ?", export.ID)
+	}
+	if len(expired) > 0 {
+		log.Printf("EXPORT: removed %d expired exports", len(expired))
+	}
+}
+
+// runDataExport собирает архив выгрузки и обновляет ее статус
+func runDataExport(exportID string) {
+	ctx := context.Background()
+	writeDB := db.GetWriteDB(ctx)
+
+	var export models.DataExport
+	if err := writeDB.Where("id = ?", exportID).First(&export).Error; err != nil {
+		log.Printf("EXPORT: failed to load export %s: %v", exportID, err)
+		return
+	}
+	writeDB.Model(&export).Update("status", models.ExportStatusProcessing)
+
+	conf := config.GetExportConfig()
+	path := filepath.Join(conf.Dir, fmt.Sprintf("user_%d_%s.zip", export.UserID, export.ID))
+	size, err := buildDataExport(ctx, export.UserID, path)
+	if err != nil {
+		log.Printf("EXPORT: export %s for user %d failed: %v", export.ID, export.UserID, err)
+		writeDB.Model(&export).Updates(map[string]interface{}{
+			"status": models.ExportStatusFailed,
+			"error":  truncate(err.Error(), 512),
+		})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(conf.TTL) * time.Second)
+	writeDB.Model(&export).Updates(map[string]interface{}{
+		"status":       models.ExportStatusReady,
+		"file_path":    path,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	})
+	log.Printf("EXPORT: export %s for user %d is ready (%d bytes)", export.ID, export.UserID, size)
+}
+
+// buildDataExport пишет zip-архив с JSON-файлами данных пользователя и возвращает его размер.
+// Архив сначала пишется во временный файл, чтобы по пути path никогда не лежал недописанный архив
+func buildDataExport(ctx context.Context, userID int64, path string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+
+	zw := zip.NewWriter(file)
+	parts := []struct {
+		name    string
+		collect func(ctx context.Context, userID int64) (interface{}, error)
+	}{
+		{"profile.json", exportProfile},
+		{"interests.json", exportInterests},
+		{"privacy.json", exportPrivacy},
+		{"friendships.json", exportFriendships},
+		{"follows.json", exportFollows},
+		{"blocks.json", exportBlocks},
+		{"suggestion_dismissals.json", exportSuggestionDismissals},
+		{"posts.json", exportPosts},
+		{"post_revisions.json", exportPostRevisions},
+		{"media.json", exportMedia},
+		{"counters.json", exportCounters},
+		{"messages.json", exportMessages},
+	}
+	for _, part := range parts {
+		data, err := part.collect(ctx, userID)
+		if err == nil {
+			err = writeZipJSON(zw, part.name, data)
+		}
+		if err != nil {
+			zw.Close()
+			file.Close()
+			return 0, fmt.Errorf("%s: %w", part.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, data interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+func exportProfile(ctx context.Context, userID int64) (interface{}, error) {
+	var user models.User
+	if err := db.GetReadOnlyDB(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return exportedProfile{User: user, Email: user.Email}, nil
+}
+
+func exportInterests(ctx context.Context, userID int64) (interface{}, error) {
+	interests := []models.Interest{}
+	var interestIDs []int64
+	err := db.GetReadOnlyDB(ctx).Model(&models.UserInterest{}).
+		Where("user_id = ?", userID).
+		Pluck("interest_id", &interestIDs).Error
+	if err != nil || len(interestIDs) == 0 {
+		return interests, err
+	}
+	err = db.GetReadOnlyDB(ctx).Where("id IN ?", interestIDs).Order("name").Find(&interests).Error
+	return interests, err
+}
+
+func exportPrivacy(ctx context.Context, userID int64) (interface{}, error) {
+	return GetPrivacySettings(ctx, userID)
+}
+
+func exportFollows(ctx context.Context, userID int64) (interface{}, error) {
+	follows := []models.Follow{}
+	err := db.GetReadOnlyDB(ctx).
+		Where("follower_id = ? OR followee_id = ?", userID, userID).
+		Order("created_at").
+		Find(&follows).Error
+	return follows, err
+}
+
+func exportBlocks(ctx context.Context, userID int64) (interface{}, error) {
+	blocks := []models.UserBlock{}
+	err := db.GetReadOnlyDB(ctx).Where("user_id = ?", userID).Order("created_at").Find(&blocks).Error
+	return blocks, err
+}
+
+func exportSuggestionDismissals(ctx context.Context, userID int64) (interface{}, error) {
+	dismissals := []models.SuggestionDismissal{}
+	err := db.GetReadOnlyDB(ctx).Where("user_id = ?", userID).Order("created_at").Find(&dismissals).Error
+	return dismissals, err
+}
+
+func exportFriendships(ctx context.Context, userID int64) (interface{}, error) {
+	friendships := []models.Friend{}
+	err := db.GetReadOnlyDB(ctx).
+		Where("user_id = ? OR friend_id = ?", userID, userID).
+		Order("created_at").
+		Find(&friendships).Error
+	return friendships, err
+}
+
+func exportPosts(ctx context.Context, userID int64) (interface{}, error) {
+	posts := []models.Post{}
+	err := db.GetReadOnlyDB(ctx).Where("user_id = ?", userID).Order("created_at").Find(&posts).Error
+	return posts, err
+}
+
+func exportPostRevisions(ctx context.Context, userID int64) (interface{}, error) {
+	revisions := []models.PostRevision{}
+	err := db.GetReadOnlyDB(ctx).Where("user_id = ?", userID).Order("created_at").Find(&revisions).Error
+	return revisions, err
+}
+
+func exportMedia(ctx context.Context, userID int64) (interface{}, error) {
+	media := []models.Media{}
+	if err := db.GetReadOnlyDB(ctx).Where("user_id = ?", userID).Order("created_at").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	exported := make([]exportedMedia, len(media))
+	for i, m := range media {
+		exported[i] = exportedMedia{Media: m, URL: MediaURL(m.ID)}
+	}
+	return exported, nil
+}
+
+func exportCounters(ctx context.Context, userID int64) (interface{}, error) {
+	counters := map[CounterType]int64{}
+	if RedisClient == nil {
+		return counters, nil
+	}
+	return GetCounterService().GetAllCounters(userID)
+}
+
+// exportMessages собирает сообщения пользователя из всех шардов БД и из диалогов в Redis
+func exportMessages(ctx context.Context, userID int64) (interface{}, error) {
+	messages := []exportedMessage{}
+
+	readDB := db.GetReadOnlyDB(ctx)
+	for _, table := range messageTables(readDB) {
+		var rows []models.Message
+		err := readDB.Table(table).
+			Where("from_user_id = ? OR to_user_id = ?", userID, userID).
+			Order("created_at").
+			Find(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", table, err)
+		}
+		for _, m := range rows {
+			messages = append(messages, exportedMessage{
+				Source:    table,
+				ID:        strconv.FormatInt(m.ID, 10),
+				FromID:    m.FromUserID,
+				ToID:      m.ToUserID,
+				Text:      m.Text,
+				CreatedAt: m.CreatedAt,
+				IsRead:    m.IsRead,
+			})
+		}
+	}
+
+	redisMessages, err := exportRedisMessages(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, redisMessages...)
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+// messageTables возвращает все таблицы, в которых могут лежать сообщения: общую messages и шарды messages_N
+func messageTables(database *gorm.DB) []string {
+	tables := db.MessageShardTables(database)
+	if database.Migrator().HasTable(&models.Message{}) {
+		tables = append([]string{models.Message{}.TableName()}, tables...)
+	}
+	return tables
+}
+
+// exportRedisMessages читает диалоги пользователя из sorted set'ов dialog:<min_id>:<max_id>
+func exportRedisMessages(ctx context.Context, userID int64) ([]exportedMessage, error) {
+	var messages []exportedMessage
+	if RedisClient == nil {
+		return messages, nil
+	}
+
+	keys, err := userDialogKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		members, err := RedisClient.ZRange(ctx, key, 0, -1).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redis key %s: %w", key, err)
+		}
+		for _, member := range members {
+			var m RedisMessage
+			if err := json.Unmarshal([]byte(member), &m); err != nil {
+				log.Printf("EXPORT: skipping malformed message in %s: %v", key, err)
+				continue
+			}
+			messages = append(messages, exportedMessage{
+				Source:    key,
+				ID:        m.ID,
+				FromID:    m.FromUserID.Int64(),
+				ToID:      m.ToUserID.Int64(),
+				Text:      m.Text,
+				CreatedAt: m.CreatedAt.Time(),
+				IsRead:    m.IsRead,
+			})
+		}
+	}
+	return messages, nil
+}
+
+// userDialogKeys находит ключи всех диалогов пользователя в Redis
+func userDialogKeys(ctx context.Context, userID int64) ([]string, error) {
+	id := strconv.FormatInt(userID, 10)
+	seen := make(map[string]bool)
+	var keys []string
+	for _, pattern := range []string{"dialog:" + id + ":*", "dialog:*:" + id} {
+		iter := RedisClient.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			// Шаблон может совпасть с посторонними ключами, проверяем формат dialog:<id>:<id>
+			parts := strings.Split(key, ":")
+			if len(parts) != 3 || (parts[1] != id && parts[2] != id) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"social/db"
+	"social/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCannotFollowSelf = errors.New("cannot follow yourself")
+	ErrFollowNotFound   = errors.New("not following this user")
+)
+
+// FollowProfile - пользователь в списке подписчиков или подписок
+type FollowProfile struct {
+	FriendProfile
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowList - количество подписчиков или подписок и страница списка
+type FollowList struct {
+	Count int64           `json:"count"`
+	Users []FollowProfile `json:"users"`
+}
+
+type followRow struct {
+	User       friendProfileRow `gorm:"embedded"`
+	FollowedAt time.Time
+}
+
+// FollowUser подписывает followerID на посты followeeID. Повторная подписка не считается ошибкой
+func FollowUser(ctx context.Context, followerID, followeeID int64) error {
+	if followerID == followeeID {
+		return ErrCannotFollowSelf
+	}
+	writeDB := db.GetWriteDB(ctx)
+	var count int64
+	if err := writeDB.Model(&models.User{}).Where("id = ?", followeeID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	if err := checkNotBlocked(ctx, followerID, followeeID); err != nil {
+		return err
+	}
+
+	follow := &models.Follow{FollowerID: followerID, FolloweeID: followeeID, CreatedAt: time.Now()}
+	result := writeDB.Clauses(clause.OnConflict{DoNothing: true}).Create(follow)
+	if result.Error != nil {
+		return fmt.Errorf("failed to follow user: %w", result.Error)
+	}
+	// Лента подписчика перестроится из БД уже с постами автора
+	if result.RowsAffected > 0 && RedisClient != nil {
+		if err := NewPostService().InvalidateUserFeed(ctx, followerID); err != nil {
+			log.Printf("FOLLOWS: failed to invalidate feed of user %d: %v", followerID, err)
+		}
+	}
+	return nil
+}
+
+// UnfollowUser отменяет подписку и убирает посты автора из ленты, если пользователи не друзья
+func UnfollowUser(ctx context.Context, followerID, followeeID int64) error {
+	result := db.GetWriteDB(ctx).Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFollowNotFound
+	}
+	friends, err := AreFriends(ctx, followerID, followeeID)
+	if err != nil {
+		log.Printf("FOLLOWS: failed to check friendship of %d and %d: %v", followerID, followeeID, err)
+	}
+	if !friends {
+		removeAuthorFromFeed(ctx, followerID, followeeID)
+	}
+	return nil
+}
+
+// ListFollowers возвращает подписчиков userID, начиная с последних
+func ListFollowers(ctx context.Context, viewerID, userID int64, limit, offset int) (FollowList, error) {
+	return listFollows(ctx, viewerID, userID, "followee_id", "follower_id", limit, offset)
+}
+
+// ListFollowing возвращает пользователей, на которых подписан userID, начиная с последних
+func ListFollowing(ctx context.Context, viewerID, userID int64, limit, offset int) (FollowList, error) {
+	return listFollows(ctx, viewerID, userID, "follower_id", "followee_id", limit, offset)
+}
+
+// listFollows выбирает подписки, где ownerColumn = userID, с профилями пользователей из userColumn.
+// Список доступен тем, кому доступен профиль userID; заблокировавшие viewerID в него не попадают
+func listFollows(ctx context.Context, viewerID, userID int64, ownerColumn, userColumn string, limit, offset int) (FollowList, error) {
+	result := FollowList{Users: []FollowProfile{}}
+	if viewerID != userID {
+		var users []int64
+		if err := db.GetReadOnlyDB(ctx).Model(&models.User{}).Where("id = ?", userID).Limit(1).Pluck("id", &users).Error; err != nil {
+			return result, err
+		}
+		if len(users) == 0 {
+			return result, ErrUserNotFound
+		}
+		if _, err := GetProfileAccess(ctx, viewerID, userID); err != nil {
+			return result, err
+		}
+	}
+
+	readDB := db.GetReadOnlyDB(ctx)
+	query := func() *gorm.DB {
+		query := readDB.Session(&gorm.Session{NewDB: true}).
+			Table(models.Follow{}.TableName()+" f").
+			Joins("JOIN users u ON u.id = f."+userColumn+" AND u.deleted_at IS NULL").
+			Where("f."+ownerColumn+" = ?", userID)
+		return whereNotBlockedBy(query, viewerID)
+	}
+	if err := query().Count(&result.Count).Error; err != nil {
+		return result, fmt.Errorf("failed to count follows: %w", err)
+	}
+	if result.Count == 0 || int64(offset) >= result.Count {
+		return result, nil
+	}
+
+	var rows []followRow
+	err := joinPrivacy(query()).
+		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, u.avatar_id, ps.profile, f.created_at AS followed_at").
+		Order("f.created_at DESC, f.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to get follows: %w", err)
+	}
+	for _, row := range rows {
+		result.Users = append(result.Users, FollowProfile{FriendProfile: row.User.toFriendProfile(), FollowedAt: row.FollowedAt})
+	}
+	return result, nil
+}
+
+// followerIDs возвращает подписчиков userID
+func followerIDs(ctx context.Context, tx *gorm.DB, userID int64) ([]int64, error) {
+	var ids []int64
+	err := tx.WithContext(ctx).Model(&models.Follow{}).Where("followee_id = ?", userID).Pluck("follower_id", &ids).Error
+	return ids, err
+}
+
+// mergeIDs дописывает к ids значения из extra, которых там еще нет
+func mergeIDs(ids, extra []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range extra {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const FRIENDSHIP_CHANNEL = "friendship_events" // Канал Redis для рассылки событий дружбы между инстансами
+
+// Типы WebSocket-событий об изменении дружбы
+const (
+	FriendEventRequested = "friend_request"           // пользователю отправили заявку
+	FriendEventCancelled = "friend_request_cancelled" // отправитель отозвал заявку
+	FriendEventApproved  = "friend_request_approved"  // заявку пользователя приняли
+	FriendEventRejected  = "friend_request_rejected"  // заявку пользователя отклонили
+	FriendEventRemoved   = "friend_removed"           // дружба или заявка удалена
+)
+
+// FriendshipEvent - WebSocket-событие об изменении дружбы. UserID - кто изменил дружбу,
+// RecipientID - кому адресовано событие
+type FriendshipEvent struct {
+	Event       string    `json:"event"`
+	UserID      int64     `json:"user_id"`
+	RecipientID int64     `json:"recipient_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// changeFriendship меняет счетчик заявок пользователя counterUserID на delta и выполняет apply.
+// При наличии Redis изменения идут через SAGA: если apply не удался, счетчик возвращается обратно.
+// Если недоступен сам счетчик, дружба все равно меняется, а счетчик исправит ReconcileCounter
+func changeFriendship(ctx context.Context, counterUserID, delta int64, apply func(ctx context.Context) error) error {
+	if RedisClient == nil || delta == 0 {
+		return apply(ctx)
+	}
+	applied := false
+	var applyErr error
+	err := GetCounterSagaService().HandleFriendshipChange(counterUserID, delta, func(ctx context.Context) error {
+		applied = true
+		applyErr = apply(ctx)
+		return applyErr
+	})
+	if err != nil && !applied {
+		log.Printf("FRIENDS: failed to update friend_requests counter of user %d: %v", counterUserID, err)
+		return apply(ctx)
+	}
+	// Ошибку изменения дружбы возвращаем без обертки SAGA, чтобы обработчики сопоставили ее
+	if applyErr != nil {
+		return applyErr
+	}
+	return err
+}
+
+// publishFriendshipEvent рассылает событие через Redis всем инстансам, а без Redis
+// доставляет его подключениям этого инстанса
+func publishFriendshipEvent(ctx context.Context, event string, userID, recipientID int64) {
+	e := FriendshipEvent{Event: event, UserID: userID, RecipientID: recipientID, CreatedAt: time.Now()}
+	if RedisClient != nil {
+		data, _ := json.Marshal(e)
+		err := RedisClient.Publish(ctx, FRIENDSHIP_CHANNEL, data).Err()
+		if err == nil {
+			return
+		}
+		log.Printf("FRIENDS: failed to publish %s event for user %d: %v", event, recipientID, err)
+	}
+	deliverFriendshipEvent(ctx, e)
+}
+
+// deliverFriendshipEvent отправляет событие получателю, если он подключен к этому инстансу
+func deliverFriendshipEvent(ctx context.Context, event FriendshipEvent) {
+	data, _ := json.Marshal(event)
+	sendWSFrom(ctx, event.UserID, event.RecipientID, data)
+}
+
+// StartFriendshipEvents подписывается на события дружбы других инстансов
+func StartFriendshipEvents(ctx context.Context) {
+	if RedisClient == nil {
+		return
+	}
+	sub := RedisClient.Subscribe(ctx, FRIENDSHIP_CHANNEL)
+	go func() {
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var event FriendshipEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("FRIENDS: failed to unmarshal event: %v", err)
+				continue
+			}
+			deliverFriendshipEvent(ctx, event)
+		}
+	}()
+}
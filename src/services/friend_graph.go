@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"social/db"
+	"social/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrCompareWithSelf = errors.New("cannot compare with yourself")
+
+// FriendProfile - краткий профиль в списках друзей
+type FriendProfile struct {
+	ID        int64  `json:"id"`
+	Nickname  string `json:"nickname"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	City      string `json:"city,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// MutualFriends - общие друзья двух пользователей: общее количество и страница списка
+type MutualFriends struct {
+	Count   int64           `json:"count"`
+	Friends []FriendProfile `json:"friends"`
+}
+
+type friendProfileRow struct {
+	ID        int64
+	Nickname  string
+	FirstName string
+	LastName  string
+	City      string
+	AvatarID  string
+	Profile   *string
+}
+
+// toFriendProfile скрывает город и аватар тех, кто закрыл профиль от всех
+func (row friendProfileRow) toFriendProfile() FriendProfile {
+	profile := FriendProfile{ID: row.ID, Nickname: row.Nickname, FirstName: row.FirstName, LastName: row.LastName}
+	if row.Profile == nil || *row.Profile != models.PrivacyNobody {
+		profile.City = row.City
+		if row.AvatarID != "" {
+			profile.AvatarURL = MediaThumbnailURL(row.AvatarID)
+		}
+	}
+	return profile
+}
+
+// GetMutualFriends возвращает общих друзей viewerID и otherID, упорядоченных по имени.
+// Считается на репликах пересечением двух подзапросов по индексам friends
+func GetMutualFriends(ctx context.Context, viewerID, otherID int64, limit, offset int) (MutualFriends, error) {
+	result := MutualFriends{Friends: []FriendProfile{}}
+	if err := checkFriendGraphAccess(ctx, viewerID, otherID); err != nil {
+		return result, err
+	}
+
+	readDB := db.GetReadOnlyDB(ctx)
+	newQuery := func() *gorm.DB { return readDB.Session(&gorm.Session{NewDB: true}) }
+	mutualQuery := func() *gorm.DB {
+		return newQuery().Table("users u").
+			Where("u.deleted_at IS NULL AND u.id IN (?) AND u.id IN (?)",
+				friendIDsQuery(newQuery(), viewerID), friendIDsQuery(newQuery(), otherID))
+	}
+	if err := mutualQuery().Count(&result.Count).Error; err != nil {
+		return result, fmt.Errorf("failed to count mutual friends: %w", err)
+	}
+	if result.Count == 0 || int64(offset) >= result.Count {
+		return result, nil
+	}
+
+	var rows []friendProfileRow
+	err := joinPrivacy(mutualQuery()).
+		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, u.avatar_id, ps.profile").
+		Order("u.first_name, u.last_name, u.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to get mutual friends: %w", err)
+	}
+	for _, row := range rows {
+		result.Friends = append(result.Friends, row.toFriendProfile())
+	}
+	return result, nil
+}
+
+// GetFriendshipDegree возвращает расстояние между пользователями в графе дружбы:
+// 1 - друзья, 2 - есть общий друг, 3 - дружат их друзья, 0 - дальше или не связаны
+func GetFriendshipDegree(ctx context.Context, viewerID, otherID int64) (int, error) {
+	if err := checkFriendGraphAccess(ctx, viewerID, otherID); err != nil {
+		return 0, err
+	}
+
+	if friends, err := AreFriends(ctx, viewerID, otherID); err != nil || friends {
+		return 1, err
+	}
+	if mutual, err := haveMutualFriends(ctx, viewerID, otherID); err != nil || mutual {
+		return 2, err
+	}
+
+	readDB := db.GetReadOnlyDB(ctx)
+	newQuery := func() *gorm.DB { return readDB.Session(&gorm.Session{NewDB: true}) }
+	viewerFriends := friendIDsQuery(newQuery(), viewerID)
+	otherFriends := friendIDsQuery(newQuery(), otherID)
+	var linked []int64
+	err := newQuery().Model(&models.Friend{}).
+		Select("id").
+		Where("status = ? AND ((user_id IN (?) AND friend_id IN (?)) OR (user_id IN (?) AND friend_id IN (?)))",
+			models.FriendStatusApproved, viewerFriends, otherFriends, otherFriends, viewerFriends).
+		Limit(1).
+		Scan(&linked).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to check friendship degree: %w", err)
+	}
+	if len(linked) > 0 {
+		return 3, nil
+	}
+	return 0, nil
+}
+
+// checkFriendGraphAccess проверяет, что otherID существует и его профиль доступен viewerID
+func checkFriendGraphAccess(ctx context.Context, viewerID, otherID int64) error {
+	if viewerID == otherID {
+		return ErrCompareWithSelf
+	}
+	var users []int64
+	if err := db.GetReadOnlyDB(ctx).Model(&models.User{}).Where("id = ?", otherID).Limit(1).Pluck("id", &users).Error; err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return ErrUserNotFound
+	}
+	_, err := GetProfileAccess(ctx, viewerID, otherID)
+	return err
+}
@@ -2,19 +2,110 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"social/config"
 	"social/db"
 	"social/models"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyFriends        = errors.New("friendship already exists")
+	ErrFriendRequestExists   = errors.New("friend request already pending")
+	ErrFriendRequestNotFound = errors.New("friend request not found")
+	ErrFriendRequestCooldown = errors.New("friend request was rejected recently")
+	ErrInvalidFriendSort     = errors.New("invalid sort")
 )
 
 type FriendService struct{}
 
+// Порядок сортировки списков друзей и входящих заявок
+const (
+	FriendSortRecent = "recent" // сначала недавно добавленные
+	FriendSortAlpha  = "alpha"  // по имени и фамилии
+
+	MAX_FRIEND_LIST_LIMIT = 100
+)
+
+// FriendListParams - параметры страницы списка друзей или заявок
+type FriendListParams struct {
+	Sort   string // FriendSortRecent (по умолчанию) или FriendSortAlpha
+	Limit  int
+	Cursor string
+}
+
+// FriendListItem - друг или отправитель заявки с профилем и, если он виден, онлайн-статусом.
+// Since - когда подтверждена дружба или отправлена заявка
+type FriendListItem struct {
+	FriendProfile
+	Since    time.Time  `json:"since"`
+	Online   *bool      `json:"online,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// FriendList - страница списка друзей или заявок
+type FriendList struct {
+	Users      []FriendListItem
+	NextCursor string
+}
+
+type friendListRow struct {
+	User    friendProfileRow `gorm:"embedded"`
+	Since   time.Time
+	NameKey string
+}
+
+// friendListCursor - позиция последнего выданного пользователя: Since для recent, Name для alpha
+type friendListCursor struct {
+	Since time.Time `json:"s,omitempty"`
+	Name  string    `json:"n,omitempty"`
+	ID    int64     `json:"id"`
+}
+
+func encodeFriendListCursor(cursor friendListCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFriendListCursor(value, sort string) (*friendListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor friendListCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	if (sort == FriendSortRecent && cursor.Since.IsZero()) || (sort == FriendSortAlpha && cursor.Name == "") {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// FriendRequest - исходящая заявка в друзья вместе с получателем
+type FriendRequest struct {
+	ID          int64      `json:"id"`
+	Nickname    string     `json:"nickname"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	City        string     `json:"city"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requested_at"`
+	RejectedAt  *time.Time `json:"rejected_at,omitempty"`
+}
+
 func NewFriendService() *FriendService {
 	return &FriendService{}
 }
 
-// AddFriend добавляет запрос на дружбу
+// AddFriend добавляет запрос на дружбу. Отклоненную заявку можно отправить снова
+// только после friends.reject_cooldown
 func (fs *FriendService) AddFriend(userID, friendID int64) error {
 	if userID == friendID {
 		return fmt.Errorf("cannot add yourself as friend")
@@ -30,112 +121,329 @@ func (fs *FriendService) AddFriend(userID, friendID int64) error {
 		return fmt.Errorf("one or both users do not exist")
 	}
 
-	// Проверяем, что дружба не существует
-	var existingFriend models.Friend
-	err = db.GetReadOnlyDB(context.Background()).Where(
+	// Проверяем, что дружбы или заявки еще нет. Читаем мастер, чтобы не пропустить свежий отказ
+	writeDB := db.GetWriteDB(context.Background())
+	var existing []models.Friend
+	err = writeDB.Where(
 		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))",
 		userID, friendID, friendID, userID,
-	).First(&existingFriend).Error
-
-	if err == nil {
-		// Дружба уже существует
-		if existingFriend.Status == "approved" {
-			return fmt.Errorf("friendship already exists")
-		} else {
-			return fmt.Errorf("friend request already pending")
+	).Limit(1).Find(&existing).Error
+	if err != nil {
+		return fmt.Errorf("error checking friendship: %w", err)
+	}
+	if len(existing) > 0 {
+		switch friendship := existing[0]; friendship.Status {
+		case models.FriendStatusApproved:
+			return ErrAlreadyFriends
+		case models.FriendStatusRejected:
+			// Отказавший может сам отправить заявку сразу, получивший отказ - после паузы
+			retryAt := friendship.RejectedAt.Add(time.Duration(config.GetFriendsConfig().RejectCooldown) * time.Second)
+			if friendship.UserID == userID && time.Now().Before(retryAt) {
+				return fmt.Errorf("%w, try again after %s", ErrFriendRequestCooldown, retryAt.UTC().Format(time.RFC3339))
+			}
+		default:
+			return ErrFriendRequestExists
 		}
 	}
 
-	// Создаем запрос на дружбу
-	friendship := &models.Friend{
-		UserID:    userID,
-		FriendID:  friendID,
-		Status:    "pending",
-		CreatedAt: time.Now(),
+	// Проверяем, принимает ли пользователь заявки от userID
+	if err := CheckCanSendFriendRequest(context.Background(), userID, friendID); err != nil {
+		return err
 	}
 
-	err = db.GetWriteDB(context.Background()).Create(friendship).Error
+	// Создаем запрос на дружбу, заменяя отклоненный, и увеличиваем счетчик заявок получателя
+	ctx := context.Background()
+	err = changeFriendship(ctx, friendID, 1, func(ctx context.Context) error {
+		return writeDB.Transaction(func(tx *gorm.DB) error {
+			if len(existing) > 0 {
+				if err := tx.Delete(&existing[0]).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&models.Friend{
+				UserID:    userID,
+				FriendID:  friendID,
+				Status:    models.FriendStatusPending,
+				CreatedAt: time.Now(),
+			}).Error
+		})
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create friend request: %w", err)
 	}
 
+	publishFriendshipEvent(ctx, FriendEventRequested, userID, friendID)
 	return nil
 }
 
 // ApproveFriend подтверждает дружбу
 func (fs *FriendService) ApproveFriend(userID, requesterID int64) error {
-	// Находим запрос на дружбу
-	var friendship models.Friend
-	err := db.GetWriteDB(context.Background()).Where(
-		"user_id = ? AND friend_id = ? AND status = ?",
-		requesterID, userID, "pending",
-	).First(&friendship).Error
+	ctx := context.Background()
+	now := time.Now()
+	err := changeFriendship(ctx, userID, -1, func(ctx context.Context) error {
+		result := db.GetWriteDB(ctx).Model(&models.Friend{}).
+			Where("user_id = ? AND friend_id = ? AND status = ?", requesterID, userID, models.FriendStatusPending).
+			Updates(map[string]interface{}{
+				"status":      models.FriendStatusApproved,
+				"approved_at": now,
+				"updated_at":  now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to approve friendship: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrFriendRequestNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	publishFriendshipEvent(ctx, FriendEventApproved, userID, requesterID)
+	emitFriendshipFeedUpdate(ctx, userID, requesterID, FeedActionFriendAdded)
+	return nil
+}
+
+// RejectFriend отклоняет входящую заявку. Заявка остается со статусом rejected,
+// чтобы отправитель видел отказ и не мог сразу отправить ее снова
+func (fs *FriendService) RejectFriend(userID, requesterID int64) error {
+	ctx := context.Background()
+	now := time.Now()
+	err := changeFriendship(ctx, userID, -1, func(ctx context.Context) error {
+		result := db.GetWriteDB(ctx).Model(&models.Friend{}).
+			Where("user_id = ? AND friend_id = ? AND status = ?", requesterID, userID, models.FriendStatusPending).
+			Updates(map[string]interface{}{
+				"status":      models.FriendStatusRejected,
+				"rejected_at": now,
+				"updated_at":  now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to reject friend request: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrFriendRequestNotFound
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("friend request not found")
+		return err
 	}
 
-	// Обновляем статус на approved
-	friendship.Status = "approved"
-	friendship.ApprovedAt = time.Now()
+	publishFriendshipEvent(ctx, FriendEventRejected, userID, requesterID)
+	return nil
+}
 
-	err = db.GetWriteDB(context.Background()).Save(&friendship).Error
+// CancelFriendRequest отзывает свою еще не рассмотренную заявку
+func (fs *FriendService) CancelFriendRequest(userID, friendID int64) error {
+	ctx := context.Background()
+	err := changeFriendship(ctx, friendID, -1, func(ctx context.Context) error {
+		result := db.GetWriteDB(ctx).
+			Where("user_id = ? AND friend_id = ? AND status = ?", userID, friendID, models.FriendStatusPending).
+			Delete(&models.Friend{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to cancel friend request: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrFriendRequestNotFound
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to approve friendship: %w", err)
+		return err
 	}
 
+	publishFriendshipEvent(ctx, FriendEventCancelled, userID, friendID)
 	return nil
 }
 
-// DeleteFriend удаляет дружбу
+// DeleteFriend удаляет дружбу или заявку в любом направлении. Если удаляется
+// еще не рассмотренная заявка, счетчик заявок ее получателя уменьшается.
+// Отклоненная заявка остается, чтобы ее отправитель не обошел friends.reject_cooldown
 func (fs *FriendService) DeleteFriend(userID, friendID int64) error {
-	// Удаляем все записи дружбы между пользователями
-	err := db.GetWriteDB(context.Background()).Where(
-		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))",
-		userID, friendID, friendID, userID,
-	).Delete(&models.Friend{}).Error
+	ctx := context.Background()
+	writeDB := db.GetWriteDB(ctx)
+	deletable := []string{models.FriendStatusPending, models.FriendStatusApproved}
+	var friendships []models.Friend
+	err := writeDB.Where(
+		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status IN ?",
+		userID, friendID, friendID, userID, deletable,
+	).Find(&friendships).Error
+	if err != nil {
+		return fmt.Errorf("error checking friendship: %w", err)
+	}
+	if len(friendships) == 0 {
+		return nil
+	}
 
+	event := FriendEventRemoved
+	counterUserID, delta := userID, int64(0)
+	wereFriends := false
+	for _, f := range friendships {
+		if f.Status == models.FriendStatusApproved {
+			wereFriends = true
+		}
+		if f.Status != models.FriendStatusPending {
+			continue
+		}
+		counterUserID, delta = f.FriendID, -1
+		if f.UserID == userID {
+			event = FriendEventCancelled
+		}
+	}
+
+	// Удаляем дружбу и еще не рассмотренные заявки между пользователями
+	err = changeFriendship(ctx, counterUserID, delta, func(ctx context.Context) error {
+		return db.GetWriteDB(ctx).Where(
+			"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status IN ?",
+			userID, friendID, friendID, userID, deletable,
+		).Delete(&models.Friend{}).Error
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete friendship: %w", err)
 	}
 
+	publishFriendshipEvent(ctx, event, userID, friendID)
+	if wereFriends {
+		emitFriendshipFeedUpdate(ctx, userID, friendID, FeedActionFriendRemoved)
+	}
 	return nil
 }
 
-// GetFriends возвращает список друзей пользователя
-func (fs *FriendService) GetFriends(userID int64) ([]models.User, error) {
-	var friends []models.User
+// emitFriendshipFeedUpdate обновляет закешированные ленты пользователей после изменения дружбы
+// воркером очереди или, без очереди, в фоне
+func emitFriendshipFeedUpdate(ctx context.Context, userID, friendID int64, action string) {
+	if QueueServiceInstance != nil && RedisClient != nil {
+		if err := QueueServiceInstance.EnqueueFriendshipFeedUpdate(ctx, userID, friendID, action); err == nil {
+			return
+		}
+		log.Printf("FRIENDS: failed to enqueue %s feed update for users %d and %d, updating in background", action, userID, friendID)
+	}
+	postService := NewPostService()
+	switch action {
+	case FeedActionFriendAdded:
+		go postService.backfillFriendFeeds(context.Background(), userID, friendID)
+	case FeedActionFriendRemoved:
+		go postService.stripFriendFeeds(context.Background(), userID, friendID)
+	}
+}
 
-	// Получаем всех друзей (где дружба подтверждена)
-	err := db.GetReadOnlyDB(context.Background()).
-		Table("\"user\" u").
-		Joins("JOIN friend f ON (f.user_id = u.id AND f.friend_id = ?) OR (f.friend_id = u.id AND f.user_id = ?)", userID, userID).
-		Where("f.status = ? AND u.id != ?", "approved", userID).
-		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, u.created_at").
-		Find(&friends).Error
+// GetFriends возвращает страницу друзей пользователя с профилями и онлайн-статусом
+func (fs *FriendService) GetFriends(userID int64, params FriendListParams) (*FriendList, error) {
+	return fs.listFriendProfiles(userID, params, func(query *gorm.DB) *gorm.DB {
+		return query.
+			Joins("JOIN users u ON u.id = CASE WHEN f.user_id = ? THEN f.friend_id ELSE f.user_id END", userID).
+			Where("(f.user_id = ? OR f.friend_id = ?) AND f.status = ?", userID, userID, models.FriendStatusApproved)
+	}, "f.approved_at")
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to get friends: %w", err)
+// GetPendingRequests возвращает страницу входящих заявок в друзья с профилями отправителей
+func (fs *FriendService) GetPendingRequests(userID int64, params FriendListParams) (*FriendList, error) {
+	return fs.listFriendProfiles(userID, params, func(query *gorm.DB) *gorm.DB {
+		return query.
+			Joins("JOIN users u ON u.id = f.user_id").
+			Where("f.friend_id = ? AND f.status = ?", userID, models.FriendStatusPending)
+	}, "f.created_at")
+}
+
+// listFriendProfiles выбирает на реплике строки friends f, отобранные filter, вместе с профилями
+// пользователей u. sinceColumn - время, по которому сортирует FriendSortRecent
+func (fs *FriendService) listFriendProfiles(userID int64, params FriendListParams, filter func(*gorm.DB) *gorm.DB, sinceColumn string) (*FriendList, error) {
+	if params.Sort == "" {
+		params.Sort = FriendSortRecent
+	}
+	if params.Sort != FriendSortRecent && params.Sort != FriendSortAlpha {
+		return nil, ErrInvalidFriendSort
+	}
+	if params.Limit <= 0 || params.Limit > MAX_FRIEND_LIST_LIMIT {
+		params.Limit = 50
+	}
+	var cursor *friendListCursor
+	if params.Cursor != "" {
+		var err error
+		if cursor, err = decodeFriendListCursor(params.Cursor, params.Sort); err != nil {
+			return nil, err
+		}
 	}
 
-	return friends, nil
-}
+	ctx := context.Background()
+	nameKey := "LOWER(u.first_name || ' ' || u.last_name)"
+	query := filter(db.GetReadOnlyDB(ctx).Table("friends f")).Where("u.deleted_at IS NULL")
+	query = joinPrivacy(query).
+		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, u.avatar_id, ps.profile, " +
+			sinceColumn + " AS since, " + nameKey + " AS name_key").
+		Limit(params.Limit + 1)
+	switch params.Sort {
+	case FriendSortRecent:
+		if cursor != nil {
+			query = query.Where(sinceColumn+" < ? OR ("+sinceColumn+" = ? AND u.id < ?)", cursor.Since, cursor.Since, cursor.ID)
+		}
+		query = query.Order(sinceColumn + " DESC, u.id DESC")
+	case FriendSortAlpha:
+		if cursor != nil {
+			query = query.Where(nameKey+" > ? OR ("+nameKey+" = ? AND u.id > ?)", cursor.Name, cursor.Name, cursor.ID)
+		}
+		query = query.Order(nameKey + ", u.id")
+	}
 
-// GetPendingRequests возвращает входящие заявки в друзья
-func (fs *FriendService) GetPendingRequests(userID int64) ([]models.User, error) {
-	var requesters []models.User
+	var rows []friendListRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get friends: %w", err)
+	}
 
-	// Получаем пользователей, которые отправили заявку в друзья
-	err := db.GetReadOnlyDB(context.Background()).
-		Table("\"user\" u").
-		Joins("JOIN friend f ON f.user_id = u.id").
-		Where("f.friend_id = ? AND f.status = ?", userID, "pending").
-		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, u.created_at").
-		Find(&requesters).Error
+	result := &FriendList{Users: []FriendListItem{}}
+	if len(rows) > params.Limit {
+		rows = rows[:params.Limit]
+		last := rows[len(rows)-1]
+		result.NextCursor = encodeFriendListCursor(friendListCursor{Since: last.Since, Name: last.NameKey, ID: last.User.ID})
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.User.ID
+		result.Users = append(result.Users, FriendListItem{FriendProfile: row.User.toFriendProfile(), Since: row.Since})
+	}
 
+	// Онлайн-статус необязателен: без него список все равно отдается
+	presence, err := GetPresence(ctx, userID, ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pending requests: %w", err)
+		log.Printf("FRIENDS: failed to get presence for user %d: %v", userID, err)
+		return result, nil
+	}
+	byUser := make(map[int64]Presence, len(presence))
+	for _, p := range presence {
+		byUser[p.UserID] = p
 	}
+	for i := range result.Users {
+		if p, ok := byUser[result.Users[i].ID]; ok {
+			online := p.Online
+			result.Users[i].Online = &online
+			result.Users[i].LastSeen = p.LastSeen
+		}
+	}
+	return result, nil
+}
 
-	return requesters, nil
+// GetOutgoingRequests возвращает отправленные пользователем заявки, ожидающие ответа
+// или отклоненные, начиная с последних
+func (fs *FriendService) GetOutgoingRequests(userID int64, limit, offset int) ([]FriendRequest, error) {
+	requests := []FriendRequest{}
+	err := db.GetReadOnlyDB(context.Background()).
+		Table("friends f").
+		Joins("JOIN users u ON u.id = f.friend_id AND u.deleted_at IS NULL").
+		Where("f.user_id = ? AND f.status IN ?", userID, []string{models.FriendStatusPending, models.FriendStatusRejected}).
+		Select("u.id, u.nickname, u.first_name, u.last_name, u.city, f.status, f.created_at AS requested_at, f.rejected_at").
+		Order("f.created_at DESC, f.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&requests).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outgoing requests: %w", err)
+	}
+	// У ожидающей заявки rejected_at содержит нулевое время или NULL
+	for i := range requests {
+		if requests[i].Status != models.FriendStatusRejected {
+			requests[i].RejectedAt = nil
+		}
+	}
+	return requests, nil
 }
@@ -1,10 +1,27 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"gorm.io/gorm"
+	"fmt"
 	"social/db"
 	"social/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MAX_INTEREST_LENGTH = 60 // Совпадает с размером колонки interest.name
+	MAX_USER_INTERESTS  = 50 // Максимальное количество интересов у пользователя
+)
+
+var (
+	ErrInvalidInterest  = errors.New("invalid interest")
+	ErrInterestNotFound = errors.New("interest not found")
+	ErrTooManyInterests = fmt.Errorf("too many interests, max %d", MAX_USER_INTERESTS)
+	likePatternReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 )
 
 type InterestHandler struct {
@@ -12,42 +29,221 @@ type InterestHandler struct {
 	Model *models.Interest
 }
 
+// NormalizeInterest приводит название интереса к единому виду: нижний регистр, одиночные пробелы
+func NormalizeInterest(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" || len([]rune(name)) > MAX_INTEREST_LENGTH {
+		return "", ErrInvalidInterest
+	}
+	return name, nil
+}
+
+func (i *InterestHandler) conn(ctx context.Context) *gorm.DB {
+	if i.DB != nil {
+		return i.DB.WithContext(ctx)
+	}
+	return db.GetWriteDB(ctx)
+}
+
+// Get загружает интерес по ID или, если ID не задан, по названию
 func (i *InterestHandler) Get() (interest *models.Interest, err error) {
-	err = db.ORM.Model(i.Model).Select("*").First(&interest).Error
+	query := i.conn(context.Background())
+	if i.Model.ID != 0 {
+		query = query.Where("id = ?", i.Model.ID)
+	} else {
+		name, err := NormalizeInterest(i.Model.Name)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("name = ?", name)
+	}
+	err = query.First(&interest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInterestNotFound
+	}
 	return interest, err
 }
 
+// Create создает интерес, если его еще нет, и записывает его ID в i.Model
 func (i *InterestHandler) Create() (err error) {
-	var alreadyExists bool
-	err = db.ORM.Where("name = ?", i.Model.Name).First(&alreadyExists).Error
-	if alreadyExists {
-		return errors.New("interest already exists")
+	interest, err := getOrCreateInterest(i.conn(context.Background()), i.Model.Name)
+	if err != nil {
+		return err
 	}
-	return err
+	*i.Model = *interest
+	return nil
 }
 
+// SetToUser добавляет интерес i.Model пользователю (повторное добавление не считается ошибкой)
 func (i *InterestHandler) SetToUser(userId int64) (err error) {
-	var alreadyExist bool
-	err = db.ORM.Model(&models.UserInterest{}).Where("user_id = ? AND interest_id = ?", userId, i.Model.ID).First(&alreadyExist).Error
+	if i.Model.ID == 0 {
+		return ErrInterestNotFound
+	}
+	return i.conn(context.Background()).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserInterest{UserID: userId, InterestID: i.Model.ID}).Error
+}
+
+// GetByUser возвращает интересы пользователя
+func (i *InterestHandler) GetByUser(userId int64) (interest *[]models.Interest, err error) {
+	interests, err := userInterests(i.conn(context.Background()), userId)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return &interests, nil
+}
+
+func getOrCreateInterest(tx *gorm.DB, name string) (*models.Interest, error) {
+	name, err := NormalizeInterest(name)
+	if err != nil {
+		return nil, err
+	}
+	// Параллельное создание того же интереса не приводит к ошибке уникальности
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).
+		Create(&models.Interest{Name: name}).Error; err != nil {
+		return nil, err
 	}
-	if alreadyExist {
-		return errors.New("interest already exists for user")
+	var interest models.Interest
+	if err := tx.Where("name = ?", name).First(&interest).Error; err != nil {
+		return nil, err
+	}
+	return &interest, nil
+}
+
+func userInterests(tx *gorm.DB, userID int64) ([]models.Interest, error) {
+	interests := []models.Interest{}
+	err := tx.Table(models.Interest{}.TableName()+" i").
+		Select("i.id, i.name").
+		Joins("JOIN "+models.UserInterest{}.TableName()+" ui ON ui.interest_id = i.id").
+		Where("ui.user_id = ?", userID).
+		Order("i.name").
+		Scan(&interests).Error
+	return interests, err
+}
+
+// ListInterests возвращает интересы, начинающиеся с prefix (для автодополнения), по популярности
+func ListInterests(ctx context.Context, prefix string, limit int) ([]models.Interest, error) {
+	interests := []models.Interest{}
+	query := db.GetReadOnlyDB(ctx).
+		Table(models.Interest{}.TableName() + " i").
+		Select("i.id, i.name").
+		Joins("LEFT JOIN " + models.UserInterest{}.TableName() + " ui ON ui.interest_id = i.id").
+		Group("i.id, i.name").
+		Order("COUNT(ui.id) DESC, i.name").
+		Limit(limit)
+
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	if prefix != "" {
+		query = query.Where(`i.name LIKE ? ESCAPE '\'`, likePatternReplacer.Replace(prefix)+"%")
 	}
+	err := query.Scan(&interests).Error
+	return interests, err
+}
 
-	err = db.ORM.Model(models.UserInterest{}).Create(models.UserInterest{
-		UserID:     userId,
-		InterestID: i.Model.ID,
-	}).Error
+// GetUserInterests возвращает интересы пользователя (read-only операция)
+func GetUserInterests(ctx context.Context, userID int64) ([]models.Interest, error) {
+	return userInterests(db.GetReadOnlyDB(ctx), userID)
+}
+
+// AddUserInterests добавляет пользователю интересы по названиям, создавая новые.
+// Возвращает итоговый список интересов пользователя
+func AddUserInterests(ctx context.Context, userID int64, names []string) ([]models.Interest, error) {
+	var result []models.Interest
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			interest, err := getOrCreateInterest(tx, name)
+			if err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.UserInterest{UserID: userID, InterestID: interest.ID}).Error; err != nil {
+				return err
+			}
+		}
 
-	return err
+		var err error
+		result, err = userInterests(tx, userID)
+		if err != nil {
+			return err
+		}
+		if len(result) > MAX_USER_INTERESTS {
+			return ErrTooManyInterests
+		}
+		return nil
+	})
+	return result, err
 }
 
-func (i *InterestHandler) GetByUser(userId int64) (interest *[]models.Interest, err error) {
-	err = db.ORM.Model(&models.UserInterest{}).Where("user_id = ?", userId).Scan(&interest).Error
+// RemoveUserInterest убирает интерес у пользователя
+func RemoveUserInterest(ctx context.Context, userID, interestID int64) error {
+	result := db.GetWriteDB(ctx).
+		Where("user_id = ? AND interest_id = ?", userID, interestID).
+		Delete(&models.UserInterest{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInterestNotFound
+	}
+	return nil
+}
+
+// SearchUsersByInterests ищет пользователей, у которых есть хотя бы один (или, при matchAll, каждый)
+// из перечисленных интересов. Пользователи с большим числом общих интересов идут первыми.
+// Пользователи, скрывшие детали профиля от viewerID (0 - анонимно), не находятся
+func SearchUsersByInterests(ctx context.Context, viewerID int64, names []string, matchAll bool, limit, offset int) ([]models.User, error) {
+	normalized, err := normalizeInterestNames(names)
 	if err != nil {
 		return nil, err
 	}
-	return interest, nil
+
+	readDB := db.GetReadOnlyDB(ctx)
+	matches := usersWithInterests(readDB, normalized, matchAll).
+		Select("ui.user_id, COUNT(DISTINCT ui.interest_id) AS shared")
+
+	users := []models.User{}
+	query := joinPrivacy(readDB.Table("users u").Joins("JOIN (?) m ON m.user_id = u.id", matches))
+	query = whereVisibleTo(whereSearchable(query, viewerID), "ps.profile", viewerID)
+	err = query.
+		Select("u.*").
+		Where("u.deleted_at IS NULL").
+		Order("m.shared DESC, u.id").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error
+	return users, err
+}
+
+// normalizeInterestNames нормализует названия интересов и убирает повторы
+func normalizeInterestNames(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		n, err := NormalizeInterest(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[n] {
+			seen[n] = true
+			normalized = append(normalized, n)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidInterest
+	}
+	return normalized, nil
+}
+
+// usersWithInterests строит запрос по user_interest, сгруппированный по пользователям, у которых есть
+// хотя бы один (или, при matchAll, каждый) из нормализованных интересов
+func usersWithInterests(tx *gorm.DB, normalized []string, matchAll bool) *gorm.DB {
+	query := tx.
+		Table(models.UserInterest{}.TableName()+" ui").
+		Joins("JOIN "+models.Interest{}.TableName()+" i ON i.id = ui.interest_id").
+		Where("i.name IN ?", normalized).
+		Group("ui.user_id")
+	if matchAll {
+		query = query.Having("COUNT(DISTINCT ui.interest_id) = ?", len(normalized))
+	}
+	return query
 }
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"social/config"
+	"sync"
+	"time"
+)
+
+// MailMessage - письмо пользователю
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - отправка писем. Реализация выбирается при старте сервиса
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// MailerInstance - глобальный отправщик писем
+var MailerInstance Mailer
+
+// InitMailer инициализирует отправщик писем из конфига
+func InitMailer() {
+	mailConf := config.GetMailConfig()
+	MailerInstance = &SinkMailer{From: mailConf.From, Path: mailConf.SinkPath}
+	if mailConf.SinkPath != "" {
+		log.Printf("Mailer: writing outgoing mail to %s", mailConf.SinkPath)
+	} else {
+		log.Println("Mailer: writing outgoing mail to log")
+	}
+}
+
+// getMailer возвращает отправщик писем, инициализируя его при первом обращении
+func getMailer() Mailer {
+	if MailerInstance == nil {
+		InitMailer()
+	}
+	return MailerInstance
+}
+
+// SinkMailer не отправляет письма, а дописывает их в файл (или в лог, если путь не задан).
+// Нужен для локальной разработки и тестов без SMTP
+type SinkMailer struct {
+	From string
+	Path string
+
+	mu sync.Mutex
+}
+
+func (m *SinkMailer) Send(ctx context.Context, msg MailMessage) error {
+	entry := fmt.Sprintf("Date: %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z), m.From, msg.To, msg.Subject, msg.Body)
+
+	if m.Path == "" {
+		log.Printf("Mailer: outgoing mail\n%s", entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail sink: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("failed to write mail sink: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // декодер GIF для image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"social/config"
+	"social/db"
+	"social/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MAX_POST_MEDIA = 10 // Максимальное количество изображений в посте
+
+var (
+	ErrMediaNotFound    = errors.New("media not found")
+	ErrMediaTooLarge    = errors.New("media file is too large")
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrInvalidMediaKind = errors.New("invalid media kind")
+	ErrTooManyPostMedia = fmt.Errorf("too many images in post, max %d", MAX_POST_MEDIA)
+)
+
+// mediaEncoders - поддерживаемые форматы изображений; превью сохраняется в том же формате,
+// кроме GIF (превью - первый кадр в PNG)
+var mediaEncoders = map[string]struct {
+	thumbnailType string
+	encode        func(io.Writer, image.Image) error
+}{
+	"image/jpeg": {"image/jpeg", func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, &jpeg.Options{Quality: 85}) }},
+	"image/png":  {"image/png", png.Encode},
+	"image/gif":  {"image/png", png.Encode},
+}
+
+// MediaURL возвращает ссылку на оригинал изображения
+func MediaURL(mediaID string) string {
+	return config.GetMediaConfig().BaseURL + "/" + mediaID
+}
+
+// MediaThumbnailURL возвращает ссылку на превью изображения
+func MediaThumbnailURL(mediaID string) string {
+	return MediaURL(mediaID) + "/thumbnail"
+}
+
+// ToFeedMedia возвращает описание изображения со ссылками для ответов API
+func ToFeedMedia(media models.Media) models.FeedMedia {
+	return models.FeedMedia{
+		ID:           media.ID,
+		URL:          MediaURL(media.ID),
+		ThumbnailURL: MediaThumbnailURL(media.ID),
+		Width:        media.Width,
+		Height:       media.Height,
+	}
+}
+
+// UploadMedia проверяет изображение, сохраняет оригинал и превью в BlobStore и записывает метаданные.
+// Тип файла определяется по содержимому, а не по заголовкам запроса
+func UploadMedia(ctx context.Context, userID int64, kind string, data []byte) (*models.Media, error) {
+	if kind != models.MediaKindAvatar && kind != models.MediaKindPost {
+		return nil, ErrInvalidMediaKind
+	}
+	mediaConf := config.GetMediaConfig()
+	if int64(len(data)) > mediaConf.MaxSize {
+		return nil, ErrMediaTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	encoder, ok := mediaEncoders[contentType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+
+	// Размеры проверяются до декодирования, чтобы не распаковывать огромные изображения
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrUnsupportedMedia
+	}
+	if cfg.Width*cfg.Height > mediaConf.MaxPixels {
+		return nil, ErrMediaTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedMedia
+	}
+	var thumbnail bytes.Buffer
+	if err := encoder.encode(&thumbnail, makeThumbnail(img, mediaConf.ThumbnailSize)); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	media := &models.Media{
+		ID:           id,
+		UserID:       userID,
+		Kind:         kind,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		StorageKey:   fmt.Sprintf("media/%d/%s", userID, id),
+		ThumbnailKey: fmt.Sprintf("media/%d/%s_thumb", userID, id),
+		CreatedAt:    time.Now(),
+	}
+
+	store := getBlobStore()
+	if err := store.Put(ctx, media.StorageKey, contentType, data); err != nil {
+		return nil, fmt.Errorf("failed to store media: %w", err)
+	}
+	if err := store.Put(ctx, media.ThumbnailKey, encoder.thumbnailType, thumbnail.Bytes()); err != nil {
+		deleteMediaFiles(ctx, []models.Media{*media})
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	if err := db.GetWriteDB(ctx).Create(media).Error; err != nil {
+		deleteMediaFiles(ctx, []models.Media{*media})
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetMedia возвращает метаданные изображения. Только что загруженные изображения
+// могут еще не доехать до реплики, поэтому при промахе запрос повторяется на мастере
+func GetMedia(ctx context.Context, mediaID string) (*models.Media, error) {
+	var media models.Media
+	err := db.GetReadOnlyDB(ctx).Where("id = ?", mediaID).First(&media).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = db.GetWriteDB(ctx).Where("id = ?", mediaID).First(&media).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// OpenMedia открывает оригинал или превью изображения и возвращает его тип
+func OpenMedia(ctx context.Context, mediaID string, thumbnail bool) (io.ReadCloser, string, error) {
+	media, err := GetMedia(ctx, mediaID)
+	if err != nil {
+		return nil, "", err
+	}
+	key, contentType := media.StorageKey, media.ContentType
+	if thumbnail {
+		key, contentType = media.ThumbnailKey, mediaEncoders[media.ContentType].thumbnailType
+	}
+	body, err := getBlobStore().Get(ctx, key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, "", ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return body, contentType, nil
+}
+
+// SetAvatar делает изображение аватаром пользователя; предыдущий аватар удаляется.
+// Пустой mediaID убирает аватар
+func SetAvatar(ctx context.Context, userID int64, mediaID string) error {
+	writeDB := db.GetWriteDB(ctx)
+	var user models.User
+	if err := writeDB.Select("id", "avatar_id").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if mediaID != "" {
+		var count int64
+		if err := writeDB.Model(&models.Media{}).
+			Where("id = ? AND user_id = ? AND kind = ?", mediaID, userID, models.MediaKindAvatar).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrMediaNotFound
+		}
+	}
+	if user.AvatarID == mediaID {
+		return nil
+	}
+
+	if err := writeDB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"avatar_id": mediaID, "updated_at": time.Now()}).Error; err != nil {
+		return err
+	}
+	if user.AvatarID != "" {
+		if err := deleteMediaWhere(ctx, "id = ?", user.AvatarID); err != nil {
+			log.Printf("MEDIA: failed to delete previous avatar of user %d: %v", userID, err)
+		}
+	}
+	// Аватар автора хранится в закешированных постах ленты
+	EmitProfileChanged(ctx, userID)
+	return nil
+}
+
+// attachPostMedia привязывает загруженные пользователем изображения к посту в переданном порядке
+func attachPostMedia(tx *gorm.DB, userID, postID int64, mediaIDs []string) error {
+	if len(mediaIDs) > MAX_POST_MEDIA {
+		return ErrTooManyPostMedia
+	}
+	for position, mediaID := range mediaIDs {
+		result := tx.Model(&models.Media{}).
+			Where("id = ? AND user_id = ? AND kind = ? AND post_id IS NULL", mediaID, userID, models.MediaKindPost).
+			Updates(map[string]interface{}{"post_id": postID, "position": position})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMediaNotFound
+		}
+	}
+	return nil
+}
+
+// fillFeedMedia подставляет в посты ленты изображения и ссылку на аватар автора
+func fillFeedMedia(tx *gorm.DB, posts []models.FeedPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIDs := make([]int64, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+	var media []models.Media
+	if err := tx.Where("post_id IN ?", postIDs).Order("post_id, position").Find(&media).Error; err != nil {
+		return err
+	}
+	byPost := make(map[int64][]models.FeedMedia)
+	for _, m := range media {
+		byPost[*m.PostID] = append(byPost[*m.PostID], ToFeedMedia(m))
+	}
+	for i := range posts {
+		posts[i].Media = byPost[posts[i].ID]
+		if posts[i].UserAvatar != "" {
+			posts[i].UserAvatar = MediaThumbnailURL(posts[i].UserAvatar)
+		}
+	}
+	return nil
+}
+
+// deleteMediaWhere удаляет изображения, подходящие под условие: сначала метаданные, затем файлы
+func deleteMediaWhere(ctx context.Context, query string, args ...interface{}) error {
+	var media []models.Media
+	if err := db.GetWriteDB(ctx).Where(query, args...).Find(&media).Error; err != nil {
+		return err
+	}
+	if len(media) == 0 {
+		return nil
+	}
+	ids := make([]string, len(media))
+	for i, m := range media {
+		ids[i] = m.ID
+	}
+	if err := db.GetWriteDB(ctx).Where("id IN ?", ids).Delete(&models.Media{}).Error; err != nil {
+		return err
+	}
+	deleteMediaFiles(ctx, media)
+	return nil
+}
+
+// deleteMediaFiles удаляет оригиналы и превью из BlobStore; ошибки только логируются
+func deleteMediaFiles(ctx context.Context, media []models.Media) {
+	store := getBlobStore()
+	for _, m := range media {
+		for _, key := range []string{m.StorageKey, m.ThumbnailKey} {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("MEDIA: failed to delete %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// makeThumbnail уменьшает изображение так, чтобы длинная сторона не превышала maxSide.
+// Каждый пиксель превью - среднее по соответствующей области оригинала
+func makeThumbnail(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dstW, dstH := srcW, srcH
+	if srcW > maxSide || srcH > maxSide {
+		if srcW >= srcH {
+			dstW, dstH = maxSide, max(1, srcH*maxSide/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*maxSide/srcH), maxSide
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
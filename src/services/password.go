@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"social/config"
+	"social/db"
+	"social/models"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrInvalidResetCode  = errors.New("invalid or expired reset code")
+	errInvalidHashFormat = errors.New("invalid password format")
+)
+
+// argon2Params - параметры argon2id, с которыми посчитан хеш
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+// currentArgon2Params возвращает параметры для новых хешей из конфига
+func currentArgon2Params() argon2Params {
+	conf := config.GetAuthConfig().PasswordHash
+	return argon2Params{
+		memory:      conf.Memory,
+		iterations:  conf.Iterations,
+		parallelism: conf.Parallelism,
+		saltLength:  conf.SaltLength,
+		keyLength:   conf.KeyLength,
+	}
+}
+
+// Параметры, которыми хешировались пароли до перехода на формат PHC
+var legacyArgon2Params = argon2Params{memory: 64 * 1024, iterations: 1, parallelism: 4, saltLength: 16, keyLength: 32}
+
+// hashPassword возвращает хеш пароля в формате PHC:
+// $argon2id$v=19$m=<память КиБ>,t=<итерации>,p=<потоки>$<base64 соль>$<base64 хеш>
+func hashPassword(password string) (string, error) {
+	params := currentArgon2Params()
+	salt := make([]byte, params.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, params.keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// decodePasswordHash разбирает сохраненный хеш: PHC-формат или старый hex(salt)$hex(hash)
+func decodePasswordHash(stored string) (params argon2Params, salt, hash []byte, legacy bool, err error) {
+	if !strings.HasPrefix(stored, "$") {
+		parts := strings.Split(stored, "$")
+		if len(parts) != 2 {
+			return params, nil, nil, false, errInvalidHashFormat
+		}
+		if salt, err = hex.DecodeString(parts[0]); err != nil {
+			return params, nil, nil, false, errInvalidHashFormat
+		}
+		if hash, err = hex.DecodeString(parts[1]); err != nil {
+			return params, nil, nil, false, errInvalidHashFormat
+		}
+		if len(salt) == 0 || len(hash) == 0 {
+			return params, nil, nil, false, errInvalidHashFormat
+		}
+		return legacyArgon2Params, salt, hash, true, nil
+	}
+
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil || params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	// Пустой ключ привел бы к панике в argon2.IDKey
+	if len(salt) == 0 || len(hash) == 0 {
+		return params, nil, nil, false, errInvalidHashFormat
+	}
+	params.saltLength = uint32(len(salt))
+	params.keyLength = uint32(len(hash))
+	return params, salt, hash, false, nil
+}
+
+// verifyPassword сравнивает пароль с сохраненным хешем за постоянное время.
+// needsRehash означает, что хеш в старом формате или посчитан с устаревшими параметрами
+func verifyPassword(password, stored string) (ok bool, needsRehash bool, err error) {
+	params, salt, expected, legacy, err := decodePasswordHash(stored)
+	if err != nil {
+		return false, false, err
+	}
+	hash := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(hash, expected) != 1 {
+		return false, false, nil
+	}
+	return true, legacy || params != currentArgon2Params(), nil
+}
+
+// setPassword сохраняет новый хеш пароля пользователя (запись в мастер)
+func setPassword(tx *gorm.DB, userID int64, password string) error {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":   passwordHash,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// ChangePassword меняет пароль после проверки текущего и завершает все сессии, кроме текущей
+func ChangePassword(ctx context.Context, userID int64, currentSessionID, oldPassword, newPassword string) error {
+	var user models.User
+	if err := db.GetWriteDB(ctx).Select("id", "password").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	ok, _, err := verifyPassword(oldPassword, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidPassword
+	}
+
+	if err := setPassword(db.GetWriteDB(ctx), userID, newPassword); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := RevokeOtherSessions(ctx, userID, currentSessionID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestPasswordReset выпускает одноразовый код сброса и отправляет его на почту пользователя.
+// Если пользователь не найден, у него нет почты или код уже выпущен в пределах password_reset_cooldown,
+// ошибка не возвращается, чтобы по ответу нельзя было проверить существование аккаунта
+func RequestPasswordReset(ctx context.Context, login string) error {
+	var user models.User
+	err := db.GetWriteDB(ctx).Where("nickname = ? OR (email <> '' AND email = ?)", login, login).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("PASSWORD: reset requested for unknown login")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		log.Printf("PASSWORD: reset requested for user %d without email", user.ID)
+		return nil
+	}
+	// Иначе повторными запросами можно засыпать почту письмами и аннулировать код, отправленный владельцу
+	cooldown := time.Duration(config.GetAuthConfig().PasswordResetCooldown) * time.Second
+	var recent int64
+	err = db.GetWriteDB(ctx).Model(&models.PasswordReset{}).
+		Where("user_id = ? AND used_at IS NULL AND created_at > ?", user.ID, time.Now().Add(-cooldown)).
+		Count(&recent).Error
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		log.Printf("PASSWORD: reset for user %d requested again within cooldown", user.ID)
+		return nil
+	}
+
+	code, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(config.GetAuthConfig().PasswordResetTTL) * time.Second
+	err = db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// Действует только последний выданный код
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			CodeHash:  hashToken(code),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store reset code: %w", err)
+	}
+
+	return getMailer().Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\nYour password reset code: %s\nThe code is valid for %d minutes.\n"+
+			"If you did not request a password reset, ignore this message.", user.Nickname, code, int(ttl.Minutes())),
+	})
+}
+
+// ResetPassword устанавливает новый пароль по коду сброса и завершает все сессии пользователя
+func ResetPassword(ctx context.Context, code, newPassword string) error {
+	if code == "" {
+		return ErrInvalidResetCode
+	}
+
+	var userID int64
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		err := tx.Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(code), time.Now()).
+			First(&reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetCode
+		}
+		if err != nil {
+			return err
+		}
+
+		// Условие на used_at не дает использовать код дважды при параллельных запросах
+		result := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetCode
+		}
+
+		userID = reset.UserID
+		return setPassword(tx, reset.UserID, newPassword)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeOtherSessions(ctx, userID, "")
+	return err
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"social/db"
+	"social/models"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPostNotFound     = errors.New("post not found")
+	ErrPostEditConflict = errors.New("post was edited concurrently")
+	ErrPostContentEmpty = errors.New("post without images must have content")
+)
+
+// PostHistory - текущая версия поста и страница его предыдущих версий, начиная с последней
+type PostHistory struct {
+	Post      models.Post           `json:"post"`
+	Revisions []models.PostRevision `json:"revisions"`
+}
+
+// UpdatePost меняет текст поста автора и сохраняет предыдущую версию в post_revisions.
+// Как и при создании, пустой текст допустим только у поста с изображениями.
+// Закешированный пост обновляется, а читатели, в лентах которых он есть, получают событие feed_post_updated
+func (ps *PostService) UpdatePost(ctx context.Context, userID, postID int64, content string) (*models.Post, error) {
+	var post models.Post
+	changed := false
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", postID, userID).First(&post).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPostNotFound
+			}
+			return err
+		}
+		if post.Content == content {
+			return nil
+		}
+		if content == "" {
+			var mediaCount int64
+			if err := tx.Model(&models.Media{}).Where("post_id = ?", post.ID).Count(&mediaCount).Error; err != nil {
+				return err
+			}
+			if mediaCount == 0 {
+				return ErrPostContentEmpty
+			}
+		}
+
+		now := time.Now()
+		revision := &models.PostRevision{PostID: post.ID, UserID: userID, Content: post.Content, CreatedAt: now}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+		// Обновляем, только если текст не успели изменить параллельно, иначе потеряется версия
+		result := tx.Model(&models.Post{}).
+			Where("id = ? AND content = ?", post.ID, post.Content).
+			Updates(map[string]interface{}{"content": content, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPostEditConflict
+		}
+		post.Content = content
+		post.UpdatedAt = now
+		changed = true
+		return nil
+	})
+	if errors.Is(err, ErrPostNotFound) || errors.Is(err, ErrPostEditConflict) || errors.Is(err, ErrPostContentEmpty) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update post: %w", err)
+	}
+
+	if changed {
+		go ps.propagatePostUpdate(context.Background(), post)
+	}
+	return &post, nil
+}
+
+// GetPostHistory возвращает пост и его предыдущие версии. Историю видят автор, его друзья
+// и подписчики - те, в чьих лентах может быть пост; остальным пост не показывается
+func (ps *PostService) GetPostHistory(ctx context.Context, viewerID, postID int64, limit, offset int) (*PostHistory, error) {
+	readDB := db.GetReadOnlyDB(ctx)
+	var post models.Post
+	if err := readDB.Where("id = ?", postID).First(&post).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+	if post.UserID != viewerID {
+		friends, err := AreFriends(ctx, viewerID, post.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !friends {
+			var follows int64
+			err := readDB.Model(&models.Follow{}).
+				Where("follower_id = ? AND followee_id = ?", viewerID, post.UserID).
+				Count(&follows).Error
+			if err != nil {
+				return nil, err
+			}
+			if follows == 0 {
+				return nil, ErrPostNotFound
+			}
+		}
+	}
+
+	history := &PostHistory{Post: post, Revisions: []models.PostRevision{}}
+	err := readDB.Where("post_id = ?", postID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).
+		Find(&history.Revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// propagatePostUpdate обновляет текст в кеше post:<id> и отправляет событие feed_post_updated
+// автору, друзьям и подписчикам, в чьих лентах есть пост. Незакешированная лента может
+// содержать пост после построения из БД, поэтому ее владельцы тоже получают событие
+func (ps *PostService) propagatePostUpdate(ctx context.Context, post models.Post) {
+	readerIDs := []int64{post.UserID}
+	var friendIDs []int64
+	if err := friendIDsQuery(db.GetWriteDB(ctx), post.UserID).Scan(&friendIDs).Error; err != nil {
+		log.Printf("ERROR: Failed to get friends for post update: %v", err)
+	}
+	readerIDs = mergeIDs(readerIDs, friendIDs)
+	followers, err := followerIDs(ctx, db.GetWriteDB(ctx), post.UserID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get followers for post update: %v", err)
+	}
+	readerIDs = mergeIDs(readerIDs, followers)
+
+	if RedisClient != nil {
+		ps.updateCachedPostContent(ctx, post)
+		readerIDs = readersHoldingPost(ctx, readerIDs, post.ID)
+	}
+
+	for _, readerID := range readerIDs {
+		event := FeedEvent{
+			Event:     FeedEventPostUpdated,
+			UserID:    readerID,
+			PostID:    post.ID,
+			AuthorID:  post.UserID,
+			Content:   post.Content,
+			CreatedAt: post.CreatedAt,
+			UpdatedAt: &post.UpdatedAt,
+		}
+		// Fallback: если RabbitMQ недоступен, отправляем напрямую через WebSocket
+		if err := PublishFeedEvent(ctx, event); err != nil {
+			deliverFeedEvent(ctx, event)
+		}
+	}
+}
+
+// updateCachedPostContent меняет текст закешированного поста, сохраняя TTL записи
+func (ps *PostService) updateCachedPostContent(ctx context.Context, post models.Post) {
+	postKey := fmt.Sprintf("%s%d", POST_KEY_PREFIX, post.ID)
+	val, err := RedisClient.Get(ctx, postKey).Result()
+	if err == redis.Nil {
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to read cached postID=%d: %v", post.ID, err)
+		return
+	}
+	var feedPost models.FeedPost
+	if err := json.Unmarshal([]byte(val), &feedPost); err != nil {
+		// Поврежденную запись удаляем - пост закешируется заново при построении ленты
+		RedisClient.Del(ctx, postKey)
+		return
+	}
+	feedPost.Content = post.Content
+	postData, _ := json.Marshal(feedPost)
+	if err := RedisClient.Set(ctx, postKey, postData, redis.KeepTTL).Err(); err != nil {
+		log.Printf("ERROR: Failed to update cached postID=%d: %v", post.ID, err)
+	}
+}
+
+// readersHoldingPost оставляет читателей, в закешированной ленте которых есть пост или чья лента не закеширована
+func readersHoldingPost(ctx context.Context, readerIDs []int64, postID int64) []int64 {
+	member := strconv.FormatInt(postID, 10)
+	pipe := RedisClient.Pipeline()
+	exists := make([]*redis.IntCmd, len(readerIDs))
+	scores := make([]*redis.FloatCmd, len(readerIDs))
+	for i, readerID := range readerIDs {
+		feedKey := fmt.Sprintf("%s%d", FEED_KEY_PREFIX, readerID)
+		exists[i] = pipe.Exists(ctx, feedKey)
+		scores[i] = pipe.ZScore(ctx, feedKey, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("ERROR: Failed to check feeds for postID=%d: %v", postID, err)
+		return readerIDs
+	}
+
+	holding := make([]int64, 0, len(readerIDs))
+	for i, readerID := range readerIDs {
+		if exists[i].Val() == 0 || scores[i].Err() == nil {
+			holding = append(holding, readerID)
+		}
+	}
+	return holding
+}
@@ -3,14 +3,17 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"social/config"
 	"social/db"
 	"social/models"
 	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
 const (
@@ -26,8 +29,9 @@ func NewPostService() *PostService {
 	return &PostService{}
 }
 
-// CreatePost создает новый пост и обновляет ленты друзей
-func (ps *PostService) CreatePost(ctx context.Context, userID int64, content string) (*models.Post, error) {
+// CreatePost создает новый пост и обновляет ленты друзей.
+// mediaIDs - загруженные пользователем изображения, которые прикрепляются к посту в переданном порядке
+func (ps *PostService) CreatePost(ctx context.Context, userID int64, content string, mediaIDs ...string) (*models.Post, error) {
 	log.Printf("DEBUG: CreatePost called for userID=%d, content=%s", userID, content)
 
 	post := &models.Post{
@@ -37,8 +41,16 @@ func (ps *PostService) CreatePost(ctx context.Context, userID int64, content str
 		UpdatedAt: time.Now(),
 	}
 
-	// Сохраняем пост в БД
-	err := db.GetWriteDB(ctx).Create(post).Error
+	// Сохраняем пост в БД вместе с привязкой изображений
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		return attachPostMedia(tx, userID, post.ID, mediaIDs)
+	})
+	if errors.Is(err, ErrMediaNotFound) || errors.Is(err, ErrTooManyPostMedia) {
+		return nil, err
+	}
 	if err != nil {
 		log.Printf("ERROR: Failed to create post in DB: %v", err)
 		return nil, fmt.Errorf("failed to create post: %w", err)
@@ -108,6 +120,17 @@ func (ps *PostService) buildFeedFromDB(ctx context.Context, userID int64, lastID
 		return nil, fmt.Errorf("failed to get friends: %w", err)
 	}
 
+	// Добавляем авторов, на которых пользователь подписан
+	var followeeIDs []int64
+	err = db.GetReadOnlyDB(ctx).
+		Model(&models.Follow{}).
+		Where("follower_id = ?", userID).
+		Pluck("followee_id", &followeeIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get followees: %w", err)
+	}
+	friendIDs = mergeIDs(friendIDs, followeeIDs)
+
 	if len(friendIDs) == 0 {
 		return []models.FeedPost{}, nil
 	}
@@ -115,11 +138,11 @@ func (ps *PostService) buildFeedFromDB(ctx context.Context, userID int64, lastID
 	// Добавляем самого пользователя в список
 	friendIDs = append(friendIDs, userID)
 
-	// Строим запрос для получения постов
+	// Строим запрос для получения постов; user_avatar пока содержит ID аватара, ссылку подставит fillFeedMedia
 	query := db.GetReadOnlyDB(ctx).
 		Table("posts p").
-		Select("p.id, p.user_id, u.first_name || ' ' || u.last_name as user_name, p.content, p.created_at").
-		Joins("JOIN \"users\" u ON p.user_id = u.id").
+		Select("p.id, p.user_id, u.first_name || ' ' || u.last_name as user_name, u.avatar_id as user_avatar, p.content, p.created_at").
+		Joins("JOIN \"users\" u ON p.user_id = u.id AND u.deleted_at IS NULL").
 		Where("p.user_id IN ?", friendIDs).
 		Order("p.created_at DESC, p.id DESC").
 		Limit(limit)
@@ -133,6 +156,9 @@ func (ps *PostService) buildFeedFromDB(ctx context.Context, userID int64, lastID
 	if err != nil {
 		return nil, fmt.Errorf("failed to get feed posts: %w", err)
 	}
+	if err := fillFeedMedia(db.GetReadOnlyDB(ctx), feedPosts); err != nil {
+		return nil, fmt.Errorf("failed to get feed media: %w", err)
+	}
 
 	return feedPosts, nil
 }
@@ -233,7 +259,7 @@ func (ps *PostService) cacheFeed(ctx context.Context, feedKey string, posts []mo
 	pipe.Exec(ctx)
 }
 
-// updateFriendsFeeds обновляет ленты друзей при создании нового поста
+// updateFriendsFeeds обновляет ленты друзей и подписчиков при создании нового поста
 func (ps *PostService) updateFriendsFeeds(ctx context.Context, userID int64, post *models.Post) {
 	log.Printf("DEBUG: updateFriendsFeeds called for userID=%d, postID=%d", userID, post.ID)
 
@@ -250,6 +276,21 @@ func (ps *PostService) updateFriendsFeeds(ctx context.Context, userID int64, pos
 
 	log.Printf("DEBUG: Found %d friends for userID=%d", len(friends), userID)
 
+	recipientIDs := make([]int64, 0, len(friends))
+	for _, friend := range friends {
+		if friend.UserID == userID {
+			recipientIDs = append(recipientIDs, friend.FriendID)
+		} else {
+			recipientIDs = append(recipientIDs, friend.UserID)
+		}
+	}
+	// Подписчики получают пост так же, как друзья
+	followers, err := followerIDs(ctx, db.GetReadOnlyDB(ctx), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get followers for userID=%d: %v", userID, err)
+	}
+	recipientIDs = mergeIDs(recipientIDs, followers)
+
 	// Создаем FeedPost для кеширования
 	var user models.User
 	if err := db.GetReadOnlyDB(ctx).First(&user, userID).Error; err != nil {
@@ -257,23 +298,22 @@ func (ps *PostService) updateFriendsFeeds(ctx context.Context, userID int64, pos
 		return
 	}
 
-	feedPost := models.FeedPost{
-		ID:        post.ID,
-		UserID:    post.UserID,
-		UserName:  user.FirstName + " " + user.LastName,
-		Content:   post.Content,
-		CreatedAt: post.CreatedAt,
+	feedPosts := []models.FeedPost{{
+		ID:         post.ID,
+		UserID:     post.UserID,
+		UserName:   user.FirstName + " " + user.LastName,
+		UserAvatar: user.AvatarID,
+		Content:    post.Content,
+		CreatedAt:  post.CreatedAt,
+	}}
+	// Изображения читаются с мастера: пост только что создан и мог не доехать до реплики
+	if err := fillFeedMedia(db.GetWriteDB(ctx), feedPosts); err != nil {
+		log.Printf("ERROR: Failed to get media of postID=%d: %v", post.ID, err)
 	}
+	feedPost := feedPosts[0]
 
-	// Обновляем ленты всех друзей
-	for _, friend := range friends {
-		var friendID int64
-		if friend.UserID == userID {
-			friendID = friend.FriendID
-		} else {
-			friendID = friend.UserID
-		}
-
+	// Обновляем ленты всех друзей и подписчиков
+	for _, friendID := range recipientIDs {
 		log.Printf("DEBUG: Processing friend userID=%d", friendID)
 		ps.addPostToUserFeed(ctx, friendID, feedPost)
 
@@ -344,23 +384,14 @@ func (ps *PostService) addPostToUserFeed(ctx context.Context, userID int64, feed
 
 // sendDirectWSEvent отправляет событие напрямую через WebSocket (fallback)
 func (ps *PostService) sendDirectWSEvent(userID int64, postID int64, authorID int64, content string, createdAt time.Time) {
-	pushMsg := struct {
-		Event     string    `json:"event"`
-		UserID    int64     `json:"user_id"`
-		PostID    int64     `json:"post_id"`
-		AuthorID  int64     `json:"author_id"`
-		Content   string    `json:"content"`
-		CreatedAt time.Time `json:"created_at"`
-	}{
-		Event:     "feed_posted",
+	deliverFeedEvent(context.Background(), FeedEvent{
+		Event:     FeedEventPosted,
 		UserID:    userID,
 		PostID:    postID,
 		AuthorID:  authorID,
 		Content:   content,
 		CreatedAt: createdAt,
-	}
-	pushData, _ := json.Marshal(pushMsg)
-	GlobalWSConnManager.Send(userID, pushData)
+	})
 }
 
 // DeletePost удаляет пост
@@ -372,8 +403,13 @@ func (ps *PostService) DeletePost(ctx context.Context, userID int64, postID int6
 		return fmt.Errorf("post not found or access denied: %w", err)
 	}
 
-	// Удаляем из БД
-	err = db.GetWriteDB(ctx).Delete(&post).Error
+	// Удаляем из БД вместе с историей правок
+	err = db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", postID).Delete(&models.PostRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&post).Error
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
@@ -381,6 +417,10 @@ func (ps *PostService) DeletePost(ctx context.Context, userID int64, postID int6
 	// Удаляем из кешей лент
 	go ps.removePostFromFeeds(context.Background(), userID, postID)
 
+	if err := deleteMediaWhere(ctx, "post_id = ?", postID); err != nil {
+		log.Printf("ERROR: Failed to delete media of postID=%d: %v", postID, err)
+	}
+
 	return nil
 }
 
@@ -401,7 +441,7 @@ func (ps *PostService) removePostFromFeeds(ctx context.Context, userID int64, po
 		return
 	}
 
-	// Удаляем из лент всех друзей и самого пользователя
+	// Удаляем из лент всех друзей, подписчиков и самого пользователя
 	userIDs := []int64{userID}
 	for _, friend := range friends {
 		if friend.UserID == userID {
@@ -410,6 +450,11 @@ func (ps *PostService) removePostFromFeeds(ctx context.Context, userID int64, po
 			userIDs = append(userIDs, friend.UserID)
 		}
 	}
+	followers, err := followerIDs(ctx, db.GetReadOnlyDB(ctx), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get followers for post deletion: %v", err)
+	}
+	userIDs = mergeIDs(userIDs, followers)
 
 	pipe := RedisClient.Pipeline()
 	postIDStr := strconv.FormatInt(postID, 10)
@@ -426,6 +471,176 @@ func (ps *PostService) removePostFromFeeds(ctx context.Context, userID int64, po
 	pipe.Exec(ctx)
 }
 
+// backfillFriendFeeds добавляет последние посты новых друзей в закешированные ленты друг друга.
+// Если к моменту обработки пользователи уже не дружат, ленты не меняются
+func (ps *PostService) backfillFriendFeeds(ctx context.Context, userID, friendID int64) {
+	if RedisClient == nil {
+		return
+	}
+	friends, err := areFriendsOnMaster(ctx, userID, friendID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check friendship of %d and %d: %v", userID, friendID, err)
+		return
+	}
+	if !friends {
+		return
+	}
+	limit := config.GetFriendsConfig().FeedBackfillPosts
+	ps.addAuthorPostsToFeed(ctx, userID, friendID, limit)
+	ps.addAuthorPostsToFeed(ctx, friendID, userID, limit)
+}
+
+// addAuthorPostsToFeed добавляет последние limit постов authorID в ленту feedOwnerID.
+// Незакешированная лента не создается: она целиком построится из БД при следующем запросе
+func (ps *PostService) addAuthorPostsToFeed(ctx context.Context, feedOwnerID, authorID int64, limit int) {
+	feedKey := fmt.Sprintf("%s%d", FEED_KEY_PREFIX, feedOwnerID)
+	exists, err := RedisClient.Exists(ctx, feedKey).Result()
+	if err != nil {
+		log.Printf("ERROR: Failed to check feed of userID=%d: %v", feedOwnerID, err)
+		return
+	}
+	if exists == 0 {
+		return
+	}
+
+	// Посты читаются с мастера: дружба только что подтверждена и могла не доехать до реплики
+	var feedPosts []models.FeedPost
+	err = db.GetWriteDB(ctx).
+		Table("posts p").
+		Select("p.id, p.user_id, u.first_name || ' ' || u.last_name as user_name, u.avatar_id as user_avatar, p.content, p.created_at").
+		Joins("JOIN \"users\" u ON p.user_id = u.id AND u.deleted_at IS NULL").
+		Where("p.user_id = ?", authorID).
+		Order("p.created_at DESC, p.id DESC").
+		Limit(limit).
+		Scan(&feedPosts).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get posts of userID=%d: %v", authorID, err)
+		return
+	}
+	if len(feedPosts) == 0 {
+		return
+	}
+	if err := fillFeedMedia(db.GetWriteDB(ctx), feedPosts); err != nil {
+		log.Printf("ERROR: Failed to get media of posts of userID=%d: %v", authorID, err)
+	}
+
+	pipe := RedisClient.Pipeline()
+	for _, post := range feedPosts {
+		pipe.ZAdd(ctx, feedKey, &redis.Z{
+			Score:  float64(post.CreatedAt.Unix()),
+			Member: strconv.FormatInt(post.ID, 10),
+		})
+		postKey := fmt.Sprintf("%s%d", POST_KEY_PREFIX, post.ID)
+		postData, _ := json.Marshal(post)
+		pipe.Set(ctx, postKey, postData, FEED_CACHE_TTL)
+	}
+	pipe.ZRemRangeByRank(ctx, feedKey, 0, -MAX_FEED_SIZE-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("ERROR: Failed to backfill feed of userID=%d: %v", feedOwnerID, err)
+	}
+}
+
+// stripFriendFeeds убирает посты бывших друзей из закешированных лент друг друга.
+// Посты остаются у того, кто подписан на автора, и у снова подружившихся к моменту обработки
+func (ps *PostService) stripFriendFeeds(ctx context.Context, userID, friendID int64) {
+	if RedisClient == nil {
+		return
+	}
+	friends, err := areFriendsOnMaster(ctx, userID, friendID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check friendship of %d and %d: %v", userID, friendID, err)
+		return
+	}
+	if friends {
+		return
+	}
+	for _, pair := range [][2]int64{{userID, friendID}, {friendID, userID}} {
+		readerID, authorID := pair[0], pair[1]
+		var follows int64
+		err := db.GetWriteDB(ctx).Model(&models.Follow{}).
+			Where("follower_id = ? AND followee_id = ?", readerID, authorID).
+			Count(&follows).Error
+		if err != nil {
+			log.Printf("ERROR: Failed to check follow of %d to %d: %v", readerID, authorID, err)
+			continue
+		}
+		if follows == 0 {
+			removeAuthorFromFeed(ctx, readerID, authorID)
+		}
+	}
+}
+
+// refreshAuthorInPostCache обновляет имя и аватар автора в закешированных постах post:<id> после изменения профиля.
+// TTL записей сохраняется, отсутствующие в кеше посты пропускаются
+func (ps *PostService) refreshAuthorInPostCache(ctx context.Context, userID int64) {
+	if RedisClient == nil {
+		return
+	}
+
+	var user models.User
+	if err := db.GetWriteDB(ctx).First(&user, userID).Error; err != nil {
+		log.Printf("ERROR: Failed to get user data for userID=%d: %v", userID, err)
+		return
+	}
+	userName := user.FirstName + " " + user.LastName
+	userAvatar := ""
+	if user.AvatarID != "" {
+		userAvatar = MediaThumbnailURL(user.AvatarID)
+	}
+
+	// В кеше лент лежат не больше MAX_FEED_SIZE последних постов
+	var postIDs []int64
+	err := db.GetReadOnlyDB(ctx).Model(&models.Post{}).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(MAX_FEED_SIZE).
+		Pluck("id", &postIDs).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get posts of userID=%d: %v", userID, err)
+		return
+	}
+	if len(postIDs) == 0 {
+		return
+	}
+
+	pipe := RedisClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(postIDs))
+	for i, postID := range postIDs {
+		cmds[i] = pipe.Get(ctx, fmt.Sprintf("%s%d", POST_KEY_PREFIX, postID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("ERROR: Failed to read cached posts of userID=%d: %v", userID, err)
+		return
+	}
+
+	updated := 0
+	pipe = RedisClient.Pipeline()
+	for _, cmd := range cmds {
+		val, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+		var feedPost models.FeedPost
+		if err := json.Unmarshal([]byte(val), &feedPost); err != nil ||
+			(feedPost.UserName == userName && feedPost.UserAvatar == userAvatar) {
+			continue
+		}
+		feedPost.UserName = userName
+		feedPost.UserAvatar = userAvatar
+		postData, _ := json.Marshal(feedPost)
+		pipe.Set(ctx, fmt.Sprintf("%s%d", POST_KEY_PREFIX, feedPost.ID), postData, redis.KeepTTL)
+		updated++
+	}
+	if updated == 0 {
+		return
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("ERROR: Failed to update cached posts of userID=%d: %v", userID, err)
+		return
+	}
+	log.Printf("Updated author in %d cached posts of userID=%d", updated, userID)
+}
+
 // InvalidateUserFeed инвалидирует кеш ленты пользователя
 func (ps *PostService) InvalidateUserFeed(ctx context.Context, userID int64) error {
 	if RedisClient == nil {
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"social/config"
+	"social/db"
+	"social/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	PRESENCE_KEY_PREFIX  = "presence:"       // Хеш: инстанс -> время последнего подтверждения подключения
+	LAST_SEEN_KEY_PREFIX = "last_seen:"      // Время последней активности пользователя
+	PRESENCE_CHANNEL     = "presence_events" // Канал Redis для рассылки изменений статуса между инстансами
+	LAST_SEEN_TTL        = 30 * 24 * time.Hour
+	MAX_PRESENCE_BATCH   = 100
+)
+
+var ErrTooManyPresenceIDs = fmt.Errorf("at most %d user ids are allowed", MAX_PRESENCE_BATCH)
+
+// PresenceInstanceID - идентификатор этого инстанса сервера в хешах присутствия
+var PresenceInstanceID = fmt.Sprintf("%s-%d-%d", hostname(), os.Getpid(), time.Now().UnixNano())
+
+// Presence - онлайн-статус пользователя
+type Presence struct {
+	UserID   int64      `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// PresenceEvent - WebSocket-событие об изменении онлайн-статуса друга
+type PresenceEvent struct {
+	Event    string    `json:"event"`
+	UserID   int64     `json:"user_id"`
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// localLastSeen хранит время последней активности, когда Redis недоступен
+var localLastSeen = struct {
+	sync.Mutex
+	times map[int64]time.Time
+}{times: make(map[int64]time.Time)}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+func presenceTTL() time.Duration {
+	return time.Duration(config.GetPresenceConfig().TTL) * time.Second
+}
+
+// ConnectWS регистрирует WebSocket-подключение. Если пользователь не был онлайн ни на одном
+// инстансе, друзья получают событие presence
+func ConnectWS(ctx context.Context, userID int64, conn *websocket.Conn) {
+	if !GlobalWSConnManager.Add(userID, conn) {
+		return
+	}
+	now := time.Now()
+	wasOnline := onlineOnOtherInstances(ctx, userID, now)
+	touchPresence(ctx, []int64{userID}, now)
+	if !wasOnline {
+		publishPresence(ctx, userID, true, now)
+	}
+}
+
+// DisconnectWS снимает WebSocket-подключение. Когда у пользователя не остается подключений
+// ни на одном инстансе, запоминается время последнего визита и друзья получают событие presence
+func DisconnectWS(ctx context.Context, userID int64, conn *websocket.Conn) {
+	if !GlobalWSConnManager.Remove(userID, conn) {
+		return
+	}
+	now := time.Now()
+	setLastSeen(ctx, userID, now)
+	if RedisClient != nil {
+		RedisClient.HDel(ctx, fmt.Sprintf("%s%d", PRESENCE_KEY_PREFIX, userID), PresenceInstanceID)
+	}
+	if !onlineOnOtherInstances(ctx, userID, now) {
+		publishPresence(ctx, userID, false, now)
+	}
+}
+
+// StartPresence запускает подтверждение подключенных пользователей и, если есть Redis,
+// прием изменений статуса от других инстансов
+func StartPresence(ctx context.Context) {
+	interval := time.Duration(config.GetPresenceConfig().HeartbeatInterval) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				touchPresence(ctx, GlobalWSConnManager.OnlineUserIDs(), time.Now())
+			}
+		}
+	}()
+
+	if RedisClient == nil {
+		return
+	}
+	sub := RedisClient.Subscribe(ctx, PRESENCE_CHANNEL)
+	go func() {
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var event PresenceEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("PRESENCE: failed to unmarshal event: %v", err)
+				continue
+			}
+			deliverPresence(ctx, event)
+		}
+	}()
+}
+
+// touchPresence подтверждает, что пользователи подключены к этому инстансу
+func touchPresence(ctx context.Context, userIDs []int64, now time.Time) {
+	if len(userIDs) == 0 {
+		return
+	}
+	if RedisClient == nil {
+		for _, userID := range userIDs {
+			setLastSeen(ctx, userID, now)
+		}
+		return
+	}
+	pipe := RedisClient.Pipeline()
+	for _, userID := range userIDs {
+		key := fmt.Sprintf("%s%d", PRESENCE_KEY_PREFIX, userID)
+		pipe.HSet(ctx, key, PresenceInstanceID, now.Unix())
+		pipe.Expire(ctx, key, presenceTTL())
+		pipe.Set(ctx, fmt.Sprintf("%s%d", LAST_SEEN_KEY_PREFIX, userID), now.Unix(), LAST_SEEN_TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("PRESENCE: heartbeat failed: %v", err)
+	}
+}
+
+func setLastSeen(ctx context.Context, userID int64, at time.Time) {
+	if RedisClient != nil {
+		err := RedisClient.Set(ctx, fmt.Sprintf("%s%d", LAST_SEEN_KEY_PREFIX, userID), at.Unix(), LAST_SEEN_TTL).Err()
+		if err == nil {
+			return
+		}
+		log.Printf("PRESENCE: failed to save last seen of user %d: %v", userID, err)
+	}
+	localLastSeen.Lock()
+	localLastSeen.times[userID] = at
+	localLastSeen.Unlock()
+}
+
+// freshInstances проверяет, подтвержден ли хотя бы один инстанс из хеша присутствия в пределах TTL
+func freshInstances(instances map[string]string, now time.Time, skip string) bool {
+	threshold := now.Add(-presenceTTL()).Unix()
+	for instance, value := range instances {
+		if instance == skip {
+			continue
+		}
+		if seen, err := strconv.ParseInt(value, 10, 64); err == nil && seen >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// onlineOnOtherInstances проверяет, подключен ли пользователь к другим инстансам
+func onlineOnOtherInstances(ctx context.Context, userID int64, now time.Time) bool {
+	if RedisClient == nil {
+		return false
+	}
+	instances, err := RedisClient.HGetAll(ctx, fmt.Sprintf("%s%d", PRESENCE_KEY_PREFIX, userID)).Result()
+	if err != nil {
+		log.Printf("PRESENCE: failed to read presence of user %d: %v", userID, err)
+		return false
+	}
+	return freshInstances(instances, now, PresenceInstanceID)
+}
+
+// publishPresence рассылает изменение статуса всем инстансам; без Redis - только своему
+func publishPresence(ctx context.Context, userID int64, online bool, at time.Time) {
+	settings, err := GetPrivacySettings(ctx, userID)
+	if err != nil {
+		log.Printf("PRESENCE: failed to get privacy settings of user %d: %v", userID, err)
+		return
+	}
+	if settings.Presence == models.PrivacyNobody {
+		return
+	}
+	event := PresenceEvent{Event: "presence", UserID: userID, Online: online, LastSeen: at}
+	if RedisClient != nil {
+		data, _ := json.Marshal(event)
+		err := RedisClient.Publish(ctx, PRESENCE_CHANNEL, data).Err()
+		if err == nil {
+			return
+		}
+		log.Printf("PRESENCE: failed to publish event of user %d: %v", userID, err)
+	}
+	deliverPresence(ctx, event)
+}
+
+// deliverPresence отправляет событие друзьям пользователя, подключенным к этому инстансу
+func deliverPresence(ctx context.Context, event PresenceEvent) {
+	var friendIDs []int64
+	if err := friendIDsQuery(db.GetReadOnlyDB(ctx), event.UserID).Scan(&friendIDs).Error; err != nil {
+		log.Printf("PRESENCE: failed to get friends of user %d: %v", event.UserID, err)
+		return
+	}
+	data, _ := json.Marshal(event)
+	for _, friendID := range friendIDs {
+		if GlobalWSConnManager.IsOnline(friendID) {
+			sendWSFrom(ctx, event.UserID, friendID, data)
+		}
+	}
+}
+
+// GetPresence возвращает онлайн-статус пользователей, которые разрешили viewerID его видеть.
+// Скрытые от viewerID пользователи в ответ не попадают. viewerID = 0 - анонимный пользователь
+func GetPresence(ctx context.Context, viewerID int64, userIDs []int64) ([]Presence, error) {
+	if len(userIDs) > MAX_PRESENCE_BATCH {
+		return nil, ErrTooManyPresenceIDs
+	}
+	visible, err := presenceVisibleTo(ctx, viewerID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]Presence, 0, len(visible))
+	var instances []*redis.StringStringMapCmd
+	var lastSeen []*redis.StringCmd
+	if RedisClient != nil {
+		pipe := RedisClient.Pipeline()
+		for _, userID := range visible {
+			instances = append(instances, pipe.HGetAll(ctx, fmt.Sprintf("%s%d", PRESENCE_KEY_PREFIX, userID)))
+			lastSeen = append(lastSeen, pipe.Get(ctx, fmt.Sprintf("%s%d", LAST_SEEN_KEY_PREFIX, userID)))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("PRESENCE: failed to read presence: %v", err)
+			instances, lastSeen = nil, nil
+		}
+	}
+
+	for i, userID := range visible {
+		presence := Presence{UserID: userID, Online: GlobalWSConnManager.IsOnline(userID)}
+		if instances != nil {
+			presence.Online = presence.Online || freshInstances(instances[i].Val(), now, "")
+			if seen, err := lastSeen[i].Int64(); err == nil {
+				at := time.Unix(seen, 0)
+				presence.LastSeen = &at
+			}
+		} else {
+			localLastSeen.Lock()
+			if at, ok := localLastSeen.times[userID]; ok {
+				presence.LastSeen = &at
+			}
+			localLastSeen.Unlock()
+		}
+		result = append(result, presence)
+	}
+	return result, nil
+}
+
+// presenceVisibleTo оставляет пользователей, чья настройка presence разрешает доступ viewerID
+// и между которыми и viewerID нет блокировки. Порядок сохраняется, повторы убираются
+func presenceVisibleTo(ctx context.Context, viewerID int64, userIDs []int64) ([]int64, error) {
+	if len(userIDs) == 0 {
+		return []int64{}, nil
+	}
+	writeDB := db.GetWriteDB(ctx)
+	var settings []models.PrivacySettings
+	if err := writeDB.Where("user_id IN ?", userIDs).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	audience := make(map[int64]string, len(settings))
+	for _, s := range settings {
+		audience[s.UserID] = s.Presence
+	}
+
+	hidden := make(map[int64]bool)
+	friends := make(map[int64]bool)
+	if viewerID != 0 {
+		var blocked []models.UserBlock
+		err := writeDB.Where("(user_id = ? AND blocked_id IN ?) OR (blocked_id = ? AND user_id IN ?)",
+			viewerID, userIDs, viewerID, userIDs).Find(&blocked).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range blocked {
+			hidden[b.UserID] = true
+			hidden[b.BlockedID] = true
+		}
+		var friendIDs []int64
+		err = friendIDsQuery(db.GetReadOnlyDB(ctx), viewerID).
+			Where("CASE WHEN user_id = ? THEN friend_id ELSE user_id END IN ?", viewerID, userIDs).
+			Scan(&friendIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range friendIDs {
+			friends[id] = true
+		}
+	}
+
+	visible := make([]int64, 0, len(userIDs))
+	seen := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if userID == viewerID && viewerID != 0 {
+			visible = append(visible, userID)
+			continue
+		}
+		if hidden[userID] {
+			continue
+		}
+		switch audience[userID] {
+		case "", models.PrivacyEveryone:
+			visible = append(visible, userID)
+		case models.PrivacyFriends:
+			if friends[userID] {
+				visible = append(visible, userID)
+			}
+		}
+	}
+	return visible, nil
+}
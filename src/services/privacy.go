@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"social/db"
+	"social/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PRIVACY_KEY_PREFIX = "privacy:" // Префикс для кеша настроек приватности
+	PRIVACY_CACHE_TTL  = time.Hour
+)
+
+var (
+	ErrInvalidPrivacySetting    = errors.New("invalid privacy setting")
+	ErrMessagesNotAllowed       = errors.New("user does not accept messages from you")
+	ErrProfileHidden            = errors.New("profile is hidden")
+	ErrFriendRequestsNotAllowed = errors.New("user does not accept friend requests from you")
+)
+
+// PrivacyUpdate - частичное изменение настроек приватности: меняются только переданные поля
+type PrivacyUpdate struct {
+	Messages       *string
+	Profile        *string
+	Birthday       *string
+	FriendRequests *string
+	Presence       *string
+}
+
+// ProfileAccess - какие части профиля видны конкретному пользователю
+type ProfileAccess struct {
+	Details  bool // город, пол, интересы, аватар
+	Birthday bool
+}
+
+func validAudience(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrivacySettings возвращает настройки приватности пользователя (из кеша или мастера)
+func GetPrivacySettings(ctx context.Context, userID int64) (models.PrivacySettings, error) {
+	key := fmt.Sprintf("%s%d", PRIVACY_KEY_PREFIX, userID)
+	if RedisClient != nil {
+		if val, err := RedisClient.Get(ctx, key).Result(); err == nil {
+			var settings models.PrivacySettings
+			if json.Unmarshal([]byte(val), &settings) == nil {
+				settings.UserID = userID
+				return settings, nil
+			}
+		}
+	}
+
+	// Настройки читаются с мастера, чтобы изменение применялось сразу.
+	// Find вместо First: отсутствие записи - обычный случай, а не ошибка
+	settings := models.DefaultPrivacySettings(userID)
+	if err := db.GetWriteDB(ctx).Where("user_id = ?", userID).Limit(1).Find(&settings).Error; err != nil {
+		return settings, err
+	}
+
+	if RedisClient != nil {
+		data, _ := json.Marshal(settings)
+		if err := RedisClient.Set(ctx, key, data, PRIVACY_CACHE_TTL).Err(); err != nil {
+			log.Printf("PRIVACY: failed to cache settings of user %d: %v", userID, err)
+		}
+	}
+	return settings, nil
+}
+
+// UpdatePrivacySettings меняет переданные настройки приватности и возвращает итоговые
+func UpdatePrivacySettings(ctx context.Context, userID int64, update PrivacyUpdate) (models.PrivacySettings, error) {
+	settings, err := GetPrivacySettings(ctx, userID)
+	if err != nil {
+		return settings, err
+	}
+	audience := []string{models.PrivacyEveryone, models.PrivacyFriends, models.PrivacyNobody}
+	for _, field := range []struct {
+		value   *string
+		target  *string
+		allowed []string
+	}{
+		{update.Messages, &settings.Messages, audience},
+		{update.Profile, &settings.Profile, audience},
+		{update.Birthday, &settings.Birthday, audience},
+		{update.Presence, &settings.Presence, audience},
+		{update.FriendRequests, &settings.FriendRequests,
+			[]string{models.PrivacyEveryone, models.PrivacyFriendsOfFriends, models.PrivacyNobody}},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if !validAudience(*field.value, field.allowed...) {
+			return settings, ErrInvalidPrivacySetting
+		}
+		*field.target = *field.value
+	}
+	settings.UserID = userID
+	settings.UpdatedAt = time.Now()
+
+	err = db.GetWriteDB(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"messages", "profile", "birthday", "friend_requests", "presence", "updated_at"}),
+	}).Create(&settings).Error
+	if err != nil {
+		return settings, err
+	}
+	if RedisClient != nil {
+		RedisClient.Del(ctx, fmt.Sprintf("%s%d", PRIVACY_KEY_PREFIX, userID))
+	}
+	return settings, nil
+}
+
+// AreFriends проверяет, есть ли между пользователями подтвержденная дружба
+func AreFriends(ctx context.Context, userID, otherID int64) (bool, error) {
+	var count int64
+	err := db.GetReadOnlyDB(ctx).Model(&models.Friend{}).
+		Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+			userID, otherID, otherID, userID, "approved").
+		Count(&count).Error
+	return count > 0, err
+}
+
+// areFriendsOnMaster проверяет дружбу по мастеру - для проверок сразу после ее изменения
+func areFriendsOnMaster(ctx context.Context, userID, otherID int64) (bool, error) {
+	var count int64
+	err := db.GetWriteDB(ctx).Model(&models.Friend{}).
+		Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+			userID, otherID, otherID, userID, models.FriendStatusApproved).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// friendIDsQuery - подзапрос ID подтвержденных друзей пользователя
+func friendIDsQuery(tx *gorm.DB, userID int64) *gorm.DB {
+	return tx.Model(&models.Friend{}).
+		Select("CASE WHEN user_id = ? THEN friend_id ELSE user_id END", userID).
+		Where("(user_id = ? OR friend_id = ?) AND status = ?", userID, userID, "approved")
+}
+
+// haveMutualFriends проверяет, есть ли у пользователей общий друг
+func haveMutualFriends(ctx context.Context, userID, otherID int64) (bool, error) {
+	readDB := db.GetReadOnlyDB(ctx)
+	var mutual []int64
+	err := friendIDsQuery(readDB, userID).
+		Where("CASE WHEN user_id = ? THEN friend_id ELSE user_id END IN (?)", userID, friendIDsQuery(readDB, otherID)).
+		Limit(1).
+		Scan(&mutual).Error
+	return len(mutual) > 0, err
+}
+
+// allowedFor проверяет, входит ли viewerID в аудиторию audience пользователя ownerID.
+// viewerID = 0 - анонимный пользователь
+func allowedFor(ctx context.Context, audience string, viewerID, ownerID int64) (bool, error) {
+	if viewerID != 0 && viewerID == ownerID {
+		return true, nil
+	}
+	switch audience {
+	case models.PrivacyEveryone:
+		return true, nil
+	case models.PrivacyFriends:
+		if viewerID == 0 {
+			return false, nil
+		}
+		return AreFriends(ctx, viewerID, ownerID)
+	case models.PrivacyFriendsOfFriends:
+		if viewerID == 0 {
+			return false, nil
+		}
+		return haveMutualFriends(ctx, viewerID, ownerID)
+	default:
+		return false, nil
+	}
+}
+
+// CheckCanMessage проверяет, может ли fromID писать пользователю toID
+func CheckCanMessage(ctx context.Context, fromID, toID int64) error {
+	if err := checkNotBlocked(ctx, fromID, toID); err != nil {
+		return err
+	}
+	settings, err := GetPrivacySettings(ctx, toID)
+	if err != nil {
+		return err
+	}
+	ok, err := allowedFor(ctx, settings.Messages, fromID, toID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMessagesNotAllowed
+	}
+	return nil
+}
+
+// CheckCanSendFriendRequest проверяет, может ли fromID отправить заявку в друзья пользователю toID
+func CheckCanSendFriendRequest(ctx context.Context, fromID, toID int64) error {
+	if err := checkNotBlocked(ctx, fromID, toID); err != nil {
+		return err
+	}
+	settings, err := GetPrivacySettings(ctx, toID)
+	if err != nil {
+		return err
+	}
+	ok, err := allowedFor(ctx, settings.FriendRequests, fromID, toID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrFriendRequestsNotAllowed
+	}
+	return nil
+}
+
+// GetProfileAccess определяет, какие части профиля ownerID видны viewerID.
+// Если детали профиля скрыты или владелец заблокировал viewerID, возвращается ErrProfileHidden
+func GetProfileAccess(ctx context.Context, viewerID, ownerID int64) (ProfileAccess, error) {
+	if viewerID != 0 && viewerID != ownerID {
+		var blocked int64
+		err := db.GetWriteDB(ctx).Model(&models.UserBlock{}).
+			Where("user_id = ? AND blocked_id = ?", ownerID, viewerID).
+			Count(&blocked).Error
+		if err != nil {
+			return ProfileAccess{}, err
+		}
+		if blocked > 0 {
+			return ProfileAccess{}, ErrProfileHidden
+		}
+	}
+	settings, err := GetPrivacySettings(ctx, ownerID)
+	if err != nil {
+		return ProfileAccess{}, err
+	}
+	var access ProfileAccess
+	if access.Details, err = allowedFor(ctx, settings.Profile, viewerID, ownerID); err != nil {
+		return access, err
+	}
+	if !access.Details {
+		return access, ErrProfileHidden
+	}
+	if access.Birthday, err = allowedFor(ctx, settings.Birthday, viewerID, ownerID); err != nil {
+		return access, err
+	}
+	return access, nil
+}
+
+// joinPrivacy присоединяет к запросу по users u настройки приватности как ps
+func joinPrivacy(query *gorm.DB) *gorm.DB {
+	return query.Joins("LEFT JOIN " + models.PrivacySettings{}.TableName() + " ps ON ps.user_id = u.id")
+}
+
+// whereVisibleTo оставляет пользователей, у которых настройка column (ps.profile, ps.birthday)
+// разрешает доступ viewerID. Требует joinPrivacy
+func whereVisibleTo(query *gorm.DB, column string, viewerID int64) *gorm.DB {
+	condition, args := visibleToCondition(query, column, viewerID)
+	return query.Where(condition, args...)
+}
+
+// visibleToCondition возвращает SQL-условие whereVisibleTo с аргументами, чтобы использовать его и в SELECT
+func visibleToCondition(query *gorm.DB, column string, viewerID int64) (string, []interface{}) {
+	if viewerID == 0 {
+		return column + " IS NULL OR " + column + " = ?", []interface{}{models.PrivacyEveryone}
+	}
+	return column + " IS NULL OR " + column + " = ? OR u.id = ? OR (" + column + " = ? AND u.id IN (?))",
+		[]interface{}{models.PrivacyEveryone, viewerID, models.PrivacyFriends,
+			friendIDsQuery(query.Session(&gorm.Session{NewDB: true}), viewerID)}
+}
+
+// whereSearchable скрывает из поиска пользователей, закрывших профиль от всех
+// или заблокировавших viewerID
+func whereSearchable(query *gorm.DB, viewerID int64) *gorm.DB {
+	query = query.Where("ps.profile IS NULL OR ps.profile <> ? OR u.id = ?", models.PrivacyNobody, viewerID)
+	return whereNotBlockedBy(query, viewerID)
+}
@@ -18,11 +18,18 @@ const (
 	CELEBRITY_BATCH_SIZE = 100  // Размер батча для celebrity
 )
 
+// Действия с лентами при изменении дружбы
+const (
+	FeedActionFriendAdded   = "friend_added"   // добавить посты новых друзей в ленты друг друга
+	FeedActionFriendRemoved = "friend_removed" // убрать посты бывших друзей из лент друг друга
+)
+
 // FeedUpdateTask представляет задачи для обновления лент
 type FeedUpdateTask struct {
-	UserID int64       `json:"user_id"`
-	Post   models.Post `json:"post"`
-	Action string      `json:"action"` // "create", "delete"
+	UserID   int64       `json:"user_id"`
+	FriendID int64       `json:"friend_id,omitempty"` // второй участник дружбы для friend_added и friend_removed
+	Post     models.Post `json:"post"`
+	Action   string      `json:"action"` // "create", "delete", "profile_updated", "friend_added", "friend_removed"
 }
 
 type QueueService struct {
@@ -90,6 +97,12 @@ func (qs *QueueService) processTask(ctx context.Context, task *FeedUpdateTask, w
 		qs.processCreatePost(ctx, task)
 	case "delete":
 		qs.processDeletePost(ctx, task)
+	case "profile_updated":
+		qs.processProfileUpdate(ctx, task)
+	case FeedActionFriendAdded:
+		qs.postService.backfillFriendFeeds(ctx, task.UserID, task.FriendID)
+	case FeedActionFriendRemoved:
+		qs.postService.stripFriendFeeds(ctx, task.UserID, task.FriendID)
 	default:
 		log.Printf("Worker %d unknown action: %s", workerID, task.Action)
 	}
@@ -107,16 +120,33 @@ func (qs *QueueService) processDeletePost(ctx context.Context, task *FeedUpdateT
 	qs.postService.removePostFromFeeds(ctx, task.UserID, task.Post.ID)
 }
 
+// processProfileUpdate обновляет данные автора в закешированных постах
+func (qs *QueueService) processProfileUpdate(ctx context.Context, task *FeedUpdateTask) {
+	qs.postService.refreshAuthorInPostCache(ctx, task.UserID)
+}
+
 // EnqueueFeedUpdate добавляет задачу обновления ленты в очередь
 func (qs *QueueService) EnqueueFeedUpdate(ctx context.Context, userID int64, post models.Post, action string) error {
-	if RedisClient == nil {
-		return fmt.Errorf("redis not available")
-	}
-
-	task := FeedUpdateTask{
+	return qs.enqueue(ctx, FeedUpdateTask{
 		UserID: userID,
 		Post:   post,
 		Action: action,
+	})
+}
+
+// EnqueueFriendshipFeedUpdate добавляет в очередь обновление лент двух пользователей после изменения дружбы
+func (qs *QueueService) EnqueueFriendshipFeedUpdate(ctx context.Context, userID, friendID int64, action string) error {
+	return qs.enqueue(ctx, FeedUpdateTask{
+		UserID:   userID,
+		FriendID: friendID,
+		Action:   action,
+	})
+}
+
+// enqueue сериализует задачу и добавляет ее в очередь
+func (qs *QueueService) enqueue(ctx context.Context, task FeedUpdateTask) error {
+	if RedisClient == nil {
+		return fmt.Errorf("redis not available")
 	}
 
 	taskData, err := json.Marshal(task)
@@ -129,7 +159,7 @@ func (qs *QueueService) EnqueueFeedUpdate(ctx context.Context, userID int64, pos
 		return fmt.Errorf("failed to enqueue task: %w", err)
 	}
 
-	log.Printf("Enqueued feed update task for user %d, action: %s", userID, action)
+	log.Printf("Enqueued feed update task for user %d, action: %s", task.UserID, task.Action)
 	return nil
 }
 
@@ -18,14 +18,22 @@ var (
 	feedExchange  = "feed_events"
 )
 
+// Типы WebSocket-событий ленты
+const (
+	FeedEventPosted      = "feed_posted"       // новый пост
+	FeedEventPostUpdated = "feed_post_updated" // пост отредактирован
+)
+
 // FeedEvent - структура события для push feed
-// (userID - кому отправить, postID, authorID, content, createdAt)
+// (userID - кому отправить, postID, authorID, content, createdAt; для правки поста - event и updatedAt)
 type FeedEvent struct {
-	UserID    int64     `json:"user_id"`
-	PostID    int64     `json:"post_id"`
-	AuthorID  int64     `json:"author_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	Event     string     `json:"event,omitempty"` // по умолчанию FeedEventPosted
+	UserID    int64      `json:"user_id"`
+	PostID    int64      `json:"post_id"`
+	AuthorID  int64      `json:"author_id"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 // InitRabbitMQ инициализирует соединение, exchange и очередь
@@ -137,26 +145,18 @@ func StartFeedEventConsumer(ctx context.Context, queueName string) error {
 					continue
 				}
 				// Пушим событие через WebSocket
-				// Формируем красивое событие для клиента
-				pushMsg := struct {
-					Event     string    `json:"event"`
-					UserID    int64     `json:"user_id"`
-					PostID    int64     `json:"post_id"`
-					AuthorID  int64     `json:"author_id"`
-					Content   string    `json:"content"`
-					CreatedAt time.Time `json:"created_at"`
-				}{
-					Event:     "feed_posted",
-					UserID:    event.UserID,
-					PostID:    event.PostID,
-					AuthorID:  event.AuthorID,
-					Content:   event.Content,
-					CreatedAt: event.CreatedAt,
-				}
-				pushData, _ := json.Marshal(pushMsg)
-				GlobalWSConnManager.Send(event.UserID, pushData)
+				deliverFeedEvent(ctx, event)
 			}
 		}
 	}()
 	return nil
 }
+
+// deliverFeedEvent отправляет событие ленты получателю через WebSocket
+func deliverFeedEvent(ctx context.Context, event FeedEvent) {
+	if event.Event == "" {
+		event.Event = FeedEventPosted
+	}
+	pushData, _ := json.Marshal(event)
+	sendWSFrom(ctx, event.AuthorID, event.UserID, pushData)
+}
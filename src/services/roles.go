@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"social/db"
+	"social/models"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// GetUserRole возвращает роль пользователя.
+// Читаем из мастера, чтобы снятие роли действовало сразу, без лага реплики
+func GetUserRole(ctx context.Context, userID int64) (models.Role, error) {
+	var user models.User
+	if err := db.GetWriteDB(ctx).Select("id", "role").Where("id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// SetUserRole назначает пользователю роль (запись в мастер)
+func SetUserRole(ctx context.Context, userID int64, role models.Role) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+	result := db.GetWriteDB(ctx).Model(&models.User{}).Where("id = ?", userID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"social/db"
+	"social/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MAX_SEARCH_LIMIT = 1000 // Максимальный размер страницы поиска
+
+var (
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrInvalidSearchParams = errors.New("invalid search parameters")
+)
+
+// UserSearchParams - критерии поиска пользователей. Пустые поля не участвуют в фильтрации
+type UserSearchParams struct {
+	ViewerID          int64 // кто ищет (0 - анонимно); от него зависят настройки приватности
+	FirstName         string
+	LastName          string
+	City              string
+	Sex               models.Sex
+	MinAge            int
+	MaxAge            int
+	Interests         []string
+	MatchAllInterests bool
+	Limit             int
+	Cursor            string
+}
+
+// UserSearchResult - страница результатов поиска
+type UserSearchResult struct {
+	Users      []models.User
+	Total      int64
+	NextCursor string
+}
+
+// searchCursor - позиция последнего выданного пользователя в порядке (rank DESC, id ASC)
+type searchCursor struct {
+	Rank int64 `json:"r"`
+	ID   int64 `json:"id"`
+}
+
+type userSearchRow struct {
+	models.User    `gorm:"embedded"`
+	SearchRank     int64 `gorm:"column:search_rank"`
+	ProfileVisible bool  `gorm:"column:profile_visible"`
+}
+
+func encodeSearchCursor(cursor searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSearchCursor(value string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// SearchUsers ищет пользователей по имени, фамилии, городу, полу, возрасту и интересам (read-only операция).
+// Пользователям вне аудитории профиля найденного аватар не возвращается. На PostgreSQL с pg_trgm имена сравниваются нечетко и результаты упорядочены по похожести,
+// иначе используется поиск по префиксу без учета регистра. Страницы листаются курсором NextCursor
+func SearchUsers(ctx context.Context, params UserSearchParams) (*UserSearchResult, error) {
+	if params.Limit <= 0 || params.Limit > MAX_SEARCH_LIMIT {
+		params.Limit = 50
+	}
+	if params.MinAge < 0 || params.MaxAge < 0 || (params.MaxAge > 0 && params.MinAge > params.MaxAge) {
+		return nil, ErrInvalidSearchParams
+	}
+	if params.Sex != "" && params.Sex != models.MALE && params.Sex != models.FEMALE {
+		return nil, ErrInvalidSearchParams
+	}
+	var cursor *searchCursor
+	if params.Cursor != "" {
+		var err error
+		if cursor, err = decodeSearchCursor(params.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	var interests []string
+	if len(params.Interests) > 0 {
+		var err error
+		if interests, err = normalizeInterestNames(params.Interests); err != nil {
+			return nil, err
+		}
+	}
+
+	readDB := db.GetReadOnlyDB(ctx)
+	firstName := strings.TrimSpace(params.FirstName)
+	lastName := strings.TrimSpace(params.LastName)
+	fuzzy := db.TrigramEnabled()
+
+	// Фильтры по деталям профиля не должны раскрывать то, что скрыто настройками приватности
+	byDetails := strings.TrimSpace(params.City) != "" || params.Sex != "" || len(interests) > 0
+	byAge := params.MinAge > 0 || params.MaxAge > 0
+
+	filtered := func() *gorm.DB {
+		query := joinPrivacy(readDB.Table("users u")).Where("u.deleted_at IS NULL")
+		query = whereSearchable(query, params.ViewerID)
+		if byDetails || byAge {
+			query = whereVisibleTo(query, "ps.profile", params.ViewerID)
+		}
+		if byAge {
+			query = whereVisibleTo(query, "ps.birthday", params.ViewerID)
+		}
+		query = whereName(query, "u.first_name", firstName, fuzzy)
+		query = whereName(query, "u.last_name", lastName, fuzzy)
+		if city := strings.TrimSpace(params.City); city != "" {
+			query = query.Where("LOWER(u.city) = ?", strings.ToLower(city))
+		}
+		if params.Sex != "" {
+			query = query.Where("u.sex = ?", params.Sex)
+		}
+		// Возраст переводится в границы даты рождения относительно текущего дня
+		now := time.Now()
+		if params.MinAge > 0 {
+			query = query.Where("u.birthday <= ?", now.AddDate(-params.MinAge, 0, 0))
+		}
+		if params.MaxAge > 0 {
+			query = query.Where("u.birthday > ?", now.AddDate(-params.MaxAge-1, 0, 0))
+		}
+		if len(interests) > 0 {
+			query = query.Where("u.id IN (?)",
+				usersWithInterests(readDB, interests, params.MatchAllInterests).Select("ui.user_id"))
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	// Аватар - деталь профиля, поэтому отмечаем, входит ли viewer в аудиторию настройки profile
+	visible, args := visibleToCondition(readDB, "ps.profile", params.ViewerID)
+	columns := "u.*, CASE WHEN " + visible + " THEN 1 ELSE 0 END AS profile_visible"
+	ranked := filtered()
+	if fuzzy && (firstName != "" || lastName != "") {
+		ranked = ranked.Select(columns+", CAST((similarity(u.first_name, ?) + similarity(u.last_name, ?)) * 1000 AS BIGINT) AS search_rank",
+			append(args, firstName, lastName)...)
+	} else {
+		ranked = ranked.Select(columns+", 0 AS search_rank", args...)
+	}
+
+	query := readDB.Table("(?) AS s", ranked)
+	if cursor != nil {
+		query = query.Where("s.search_rank < ? OR (s.search_rank = ? AND s.id > ?)", cursor.Rank, cursor.Rank, cursor.ID)
+	}
+	var rows []userSearchRow
+	if err := query.Order("s.search_rank DESC, s.id").Limit(params.Limit + 1).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &UserSearchResult{Users: []models.User{}, Total: total}
+	if len(rows) > params.Limit {
+		rows = rows[:params.Limit]
+		last := rows[len(rows)-1]
+		result.NextCursor = encodeSearchCursor(searchCursor{Rank: last.SearchRank, ID: last.ID})
+	}
+	for _, row := range rows {
+		if !row.ProfileVisible {
+			row.User.AvatarID = ""
+		}
+		result.Users = append(result.Users, row.User)
+	}
+	return result, nil
+}
+
+// whereName добавляет условие по имени: совпадение префикса без учета регистра или, при fuzzy,
+// триграммная похожесть (оператор % из pg_trgm, использует GIN-индекс)
+func whereName(query *gorm.DB, column, value string, fuzzy bool) *gorm.DB {
+	if value == "" {
+		return query
+	}
+	prefix := likePatternReplacer.Replace(strings.ToLower(value)) + "%"
+	if fuzzy {
+		return query.Where(column+` ILIKE ? ESCAPE '\' OR `+column+" % ?", prefix, value)
+	}
+	return query.Where("LOWER("+column+`) LIKE ? ESCAPE '\'`, prefix)
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	SERVICE_NONCE_KEY_PREFIX = "service_nonce:" // Префикс для nonce подписанных межсервисных запросов
+)
+
+var (
+	localNonces   = make(map[string]time.Time)
+	localNoncesMu sync.Mutex
+)
+
+// ClaimServiceNonce запоминает nonce межсервисного запроса.
+// Возвращает false, если такой nonce уже использовался. Без Redis nonce хранятся в памяти процесса
+func ClaimServiceNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	if RedisClient != nil {
+		return RedisClient.SetNX(ctx, SERVICE_NONCE_KEY_PREFIX+nonce, 1, ttl).Result()
+	}
+
+	localNoncesMu.Lock()
+	defer localNoncesMu.Unlock()
+	now := time.Now()
+	for n, expiresAt := range localNonces {
+		if now.After(expiresAt) {
+			delete(localNonces, n)
+		}
+	}
+	if _, exists := localNonces[nonce]; exists {
+		return false, nil
+	}
+	localNonces[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"social/db"
+	"social/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Ограничения длины полей сессии (совпадают с размерами колонок user_sessions)
+const (
+	maxDeviceNameLen = 255
+	maxUserAgentLen  = 512
+	maxIPLen         = 64
+)
+
+// DeviceInfo - данные об устройстве, с которого выполнен вход
+type DeviceInfo struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
+
+// truncate обрезает строку до n байт, чтобы не упасть на ограничении колонки
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// createSession создает запись о новой сессии и возвращает ее ID (он же FamilyID токенов)
+func createSession(tx *gorm.DB, userID int64, device *DeviceInfo) (string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	if device == nil {
+		device = &DeviceInfo{}
+	}
+
+	now := time.Now()
+	err = tx.Create(&models.UserSession{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceName: truncate(device.DeviceName, maxDeviceNameLen),
+		UserAgent:  truncate(device.UserAgent, maxUserAgentLen),
+		IP:         truncate(device.IP, maxIPLen),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+	return sessionID, nil
+}
+
+// touchSession обновляет время последнего использования сессии
+func touchSession(tx *gorm.DB, sessionID string) error {
+	return tx.Model(&models.UserSession{}).
+		Where("id = ?", sessionID).
+		Update("last_used_at", time.Now()).Error
+}
+
+// ListSessions возвращает активные сессии пользователя (read-only операция).
+// Сессия активна, пока не отозвана и у нее есть действующий refresh-токен
+func ListSessions(ctx context.Context, userID int64) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	activeTokens := db.GetReadOnlyDB(ctx).Model(&models.UserTokens{}).
+		Select("family_id").
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now())
+	err := db.GetReadOnlyDB(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND id IN (?)", userID, activeTokens).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию пользователя
+func RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	var count int64
+	err := db.GetWriteDB(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+	return RevokeTokenFamily(ctx, sessionID)
+}
+
+// RevokeOtherSessions завершает все сессии пользователя, кроме текущей, и возвращает их количество
+func RevokeOtherSessions(ctx context.Context, userID int64, currentSessionID string) (int, error) {
+	var sessionIDs []string
+	err := db.GetWriteDB(ctx).Model(&models.UserSession{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+		Pluck("id", &sessionIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	err = db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserTokens{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserSession{}).
+			Where("id IN ?", sessionIDs).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	invalidateSessions(ctx, sessionIDs)
+	log.Printf("AUTH: revoked %d sessions of user %d", len(sessionIDs), userID)
+	return len(sessionIDs), nil
+}
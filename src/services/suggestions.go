@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"social/config"
+	"social/db"
+	"social/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SUGGESTIONS_KEY_PREFIX   = "suggestions:"        // Закешированные рекомендации друзей пользователя
+	SUGGESTIONS_REFRESH_KEY  = "suggestions_refresh" // Sorted set: пользователь -> время последнего пересчета
+	MAX_SUGGESTIONS          = 100                   // Сколько рекомендаций хранится для пользователя
+	SUGGESTION_CANDIDATES    = 500                   // Сколько кандидатов берется из каждого источника
+	SUGGESTION_REFRESH_BATCH = 100
+	SUGGESTION_REFRESH_TICK  = time.Minute
+
+	// Веса признаков в оценке кандидата
+	MUTUAL_FRIEND_WEIGHT   = 10
+	SHARED_INTEREST_WEIGHT = 5
+	SAME_CITY_WEIGHT       = 3
+)
+
+var ErrCannotDismissSelf = errors.New("cannot dismiss yourself")
+
+// Suggestion - рекомендованный пользователь и причины рекомендации
+type Suggestion struct {
+	ID              int64  `json:"id"`
+	Nickname        string `json:"nickname"`
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	City            string `json:"city,omitempty"`
+	AvatarURL       string `json:"avatar_url,omitempty"`
+	MutualFriends   int    `json:"mutual_friends"`
+	SharedInterests int    `json:"shared_interests"`
+	SameCity        bool   `json:"same_city"`
+	Score           int    `json:"score"`
+}
+
+type candidateCount struct {
+	CandidateID int64
+	Count       int
+}
+
+// GetSuggestions возвращает рекомендации друзей из кеша, при промахе считает их на репликах
+func GetSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	suggestions, ok := cachedSuggestions(ctx, userID)
+	if !ok {
+		var err error
+		if suggestions, err = refreshSuggestions(ctx, userID, false); err != nil {
+			return nil, err
+		}
+	}
+	// Кеш может отставать от дружбы, блокировок и скрытых рекомендаций
+	suggestions, err := filterSuggestions(ctx, userID, suggestions)
+	if err != nil {
+		return nil, err
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// DismissSuggestion скрывает пользователя из рекомендаций навсегда
+func DismissSuggestion(ctx context.Context, userID, dismissedID int64) error {
+	if userID == dismissedID {
+		return ErrCannotDismissSelf
+	}
+	writeDB := db.GetWriteDB(ctx)
+	var count int64
+	if err := writeDB.Model(&models.User{}).Where("id = ?", dismissedID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	dismissal := &models.SuggestionDismissal{UserID: userID, DismissedID: dismissedID, CreatedAt: time.Now()}
+	if err := writeDB.Clauses(clause.OnConflict{DoNothing: true}).Create(dismissal).Error; err != nil {
+		return fmt.Errorf("failed to dismiss suggestion: %w", err)
+	}
+
+	if suggestions, ok := cachedSuggestions(ctx, userID); ok {
+		kept := suggestions[:0]
+		for _, s := range suggestions {
+			if s.ID != dismissedID {
+				kept = append(kept, s)
+			}
+		}
+		cacheSuggestions(ctx, userID, kept, true)
+	}
+	return nil
+}
+
+// StartSuggestionsRefresher периодически пересчитывает рекомендации пользователей,
+// которые запрашивали их в пределах friends.suggestions_ttl
+func StartSuggestionsRefresher(ctx context.Context) {
+	if RedisClient == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(SUGGESTION_REFRESH_TICK)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				RefreshStaleSuggestions(ctx)
+			}
+		}
+	}()
+}
+
+// RefreshStaleSuggestions пересчитывает рекомендации, посчитанные раньше friends.suggestions_refresh_interval,
+// и возвращает количество пересчитанных. Пользователи с истекшим кешем перестают обновляться
+func RefreshStaleSuggestions(ctx context.Context) int {
+	if RedisClient == nil {
+		return 0
+	}
+	interval := time.Duration(config.GetFriendsConfig().SuggestionsRefreshInterval) * time.Second
+	members, err := RedisClient.ZRangeByScore(ctx, SUGGESTIONS_REFRESH_KEY, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().Add(-interval).Unix(), 10),
+		Count: SUGGESTION_REFRESH_BATCH,
+	}).Result()
+	if err != nil {
+		log.Printf("SUGGESTIONS: failed to get users to refresh: %v", err)
+		return 0
+	}
+
+	refreshed := 0
+	for _, member := range members {
+		userID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			RedisClient.ZRem(ctx, SUGGESTIONS_REFRESH_KEY, member)
+			continue
+		}
+		exists, err := RedisClient.Exists(ctx, fmt.Sprintf("%s%d", SUGGESTIONS_KEY_PREFIX, userID)).Result()
+		if err != nil {
+			log.Printf("SUGGESTIONS: failed to check cache of user %d: %v", userID, err)
+			continue
+		}
+		if exists == 0 {
+			RedisClient.ZRem(ctx, SUGGESTIONS_REFRESH_KEY, member)
+			continue
+		}
+		if _, err := refreshSuggestions(ctx, userID, true); err != nil {
+			log.Printf("SUGGESTIONS: failed to refresh suggestions of user %d: %v", userID, err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed
+}
+
+func cachedSuggestions(ctx context.Context, userID int64) ([]Suggestion, bool) {
+	if RedisClient == nil {
+		return nil, false
+	}
+	key := fmt.Sprintf("%s%d", SUGGESTIONS_KEY_PREFIX, userID)
+	val, err := RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		return nil, false
+	}
+	var suggestions []Suggestion
+	if json.Unmarshal([]byte(val), &suggestions) != nil {
+		return nil, false
+	}
+	// Каждый запрос продлевает жизнь кеша, а с ним и фоновый пересчет
+	ttl := time.Duration(config.GetFriendsConfig().SuggestionsTTL) * time.Second
+	RedisClient.Expire(ctx, key, ttl)
+	return suggestions, true
+}
+
+// cacheSuggestions сохраняет рекомендации; keepTTL - не продлевать кеш (фоновый пересчет)
+func cacheSuggestions(ctx context.Context, userID int64, suggestions []Suggestion, keepTTL bool) {
+	if RedisClient == nil {
+		return
+	}
+	ttl := time.Duration(config.GetFriendsConfig().SuggestionsTTL) * time.Second
+	if keepTTL {
+		ttl = redis.KeepTTL
+	}
+	data, _ := json.Marshal(suggestions)
+	pipe := RedisClient.Pipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s%d", SUGGESTIONS_KEY_PREFIX, userID), data, ttl)
+	pipe.ZAdd(ctx, SUGGESTIONS_REFRESH_KEY, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.FormatInt(userID, 10)})
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("SUGGESTIONS: failed to cache suggestions of user %d: %v", userID, err)
+	}
+}
+
+func refreshSuggestions(ctx context.Context, userID int64, keepTTL bool) ([]Suggestion, error) {
+	suggestions, err := computeSuggestions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cacheSuggestions(ctx, userID, suggestions, keepTTL)
+	return suggestions, nil
+}
+
+// computeSuggestions оценивает кандидатов по общим друзьям, общим интересам и городу.
+// Кандидаты берутся из друзей друзей, пользователей с общими интересами и из того же города
+func computeSuggestions(ctx context.Context, userID int64) ([]Suggestion, error) {
+	readDB := db.GetReadOnlyDB(ctx)
+	newQuery := func() *gorm.DB { return readDB.Session(&gorm.Session{NewDB: true}) }
+
+	var me models.User
+	if err := newQuery().Select("id, city").Where("id = ?", userID).Limit(1).Find(&me).Error; err != nil {
+		return nil, err
+	}
+	var myInterests []int64
+	if err := newQuery().Model(&models.UserInterest{}).Where("user_id = ?", userID).Pluck("interest_id", &myInterests).Error; err != nil {
+		return nil, err
+	}
+	myFriends := friendIDsQuery(newQuery(), userID)
+
+	// Источники кандидатов
+	candidates := make(map[int64]bool)
+	var pool []candidateCount
+	err := newQuery().Model(&models.Friend{}).
+		Select("CASE WHEN user_id IN (?) THEN friend_id ELSE user_id END AS candidate_id, COUNT(*) AS count", myFriends).
+		Where("status = ? AND (user_id IN (?) OR friend_id IN (?))", models.FriendStatusApproved, myFriends, myFriends).
+		Group("candidate_id").
+		Order("count DESC").
+		Limit(SUGGESTION_CANDIDATES).
+		Scan(&pool).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friends of friends: %w", err)
+	}
+	for _, c := range pool {
+		candidates[c.CandidateID] = true
+	}
+	if len(myInterests) > 0 {
+		pool = nil
+		err := newQuery().Model(&models.UserInterest{}).
+			Select("user_id AS candidate_id, COUNT(*) AS count").
+			Where("interest_id IN ? AND user_id <> ?", myInterests, userID).
+			Group("user_id").
+			Order("count DESC").
+			Limit(SUGGESTION_CANDIDATES).
+			Scan(&pool).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users with shared interests: %w", err)
+		}
+		for _, c := range pool {
+			candidates[c.CandidateID] = true
+		}
+	}
+	if me.City != "" {
+		var sameCity []int64
+		err := newQuery().Model(&models.User{}).
+			Where("LOWER(city) = LOWER(?) AND id <> ?", me.City, userID).
+			Order("id DESC").
+			Limit(SUGGESTION_CANDIDATES).
+			Pluck("id", &sameCity).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users from the same city: %w", err)
+		}
+		for _, id := range sameCity {
+			candidates[id] = true
+		}
+	}
+
+	// Себя, друзей, заявки, блокировки и скрытые рекомендации не предлагаем
+	excluded := []int64{userID}
+	var related []int64
+	err = newQuery().Model(&models.Friend{}).
+		Select("CASE WHEN user_id = ? THEN friend_id ELSE user_id END", userID).
+		Where("user_id = ? OR friend_id = ?", userID, userID).
+		Scan(&related).Error
+	if err != nil {
+		return nil, err
+	}
+	excluded = append(excluded, related...)
+	related = nil
+	err = newQuery().Model(&models.UserBlock{}).
+		Select("CASE WHEN user_id = ? THEN blocked_id ELSE user_id END", userID).
+		Where("user_id = ? OR blocked_id = ?", userID, userID).
+		Scan(&related).Error
+	if err != nil {
+		return nil, err
+	}
+	excluded = append(excluded, related...)
+	related = nil
+	if err := newQuery().Model(&models.SuggestionDismissal{}).Where("user_id = ?", userID).Pluck("dismissed_id", &related).Error; err != nil {
+		return nil, err
+	}
+	excluded = append(excluded, related...)
+	for _, id := range excluded {
+		delete(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return []Suggestion{}, nil
+	}
+	candidateIDs := make([]int64, 0, len(candidates))
+	for id := range candidates {
+		candidateIDs = append(candidateIDs, id)
+	}
+
+	// Точные значения признаков для всех кандидатов
+	var users []models.User
+	if err := newQuery().Where("id IN ?", candidateIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	var settings []models.PrivacySettings
+	if err := newQuery().Where("user_id IN ?", candidateIDs).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	profileAudience := make(map[int64]string, len(settings))
+	for _, s := range settings {
+		profileAudience[s.UserID] = s.Profile
+	}
+	var mutual []candidateCount
+	err = newQuery().Model(&models.Friend{}).
+		Select("CASE WHEN user_id IN ? THEN user_id ELSE friend_id END AS candidate_id, "+
+			"COUNT(DISTINCT CASE WHEN user_id IN ? THEN friend_id ELSE user_id END) AS count", candidateIDs, candidateIDs).
+		Where("status = ? AND ((user_id IN ? AND friend_id IN (?)) OR (friend_id IN ? AND user_id IN (?)))",
+			models.FriendStatusApproved, candidateIDs, myFriends, candidateIDs, myFriends).
+		Group("candidate_id").
+		Scan(&mutual).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count mutual friends: %w", err)
+	}
+	mutualCounts := make(map[int64]int, len(mutual))
+	for _, c := range mutual {
+		mutualCounts[c.CandidateID] = c.Count
+	}
+	sharedCounts := make(map[int64]int)
+	if len(myInterests) > 0 {
+		var shared []candidateCount
+		err := newQuery().Model(&models.UserInterest{}).
+			Select("user_id AS candidate_id, COUNT(*) AS count").
+			Where("user_id IN ? AND interest_id IN ?", candidateIDs, myInterests).
+			Group("user_id").
+			Scan(&shared).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to count shared interests: %w", err)
+		}
+		for _, c := range shared {
+			sharedCounts[c.CandidateID] = c.Count
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(users))
+	for _, user := range users {
+		suggestion := Suggestion{
+			ID:            user.ID,
+			Nickname:      user.Nickname,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			MutualFriends: mutualCounts[user.ID],
+		}
+		switch profileAudience[user.ID] {
+		case models.PrivacyNobody:
+			// Скрытых от всех пользователей не рекомендуем, как и не находим в поиске
+			continue
+		case "", models.PrivacyEveryone:
+			// Город и интересы видны всем - учитываем их
+			suggestion.City = user.City
+			if user.AvatarID != "" {
+				suggestion.AvatarURL = MediaThumbnailURL(user.AvatarID)
+			}
+			suggestion.SharedInterests = sharedCounts[user.ID]
+			suggestion.SameCity = me.City != "" && strings.EqualFold(user.City, me.City)
+		}
+		suggestion.Score = suggestion.MutualFriends*MUTUAL_FRIEND_WEIGHT + suggestion.SharedInterests*SHARED_INTEREST_WEIGHT
+		if suggestion.SameCity {
+			suggestion.Score += SAME_CITY_WEIGHT
+		}
+		if suggestion.Score > 0 {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		if suggestions[i].MutualFriends != suggestions[j].MutualFriends {
+			return suggestions[i].MutualFriends > suggestions[j].MutualFriends
+		}
+		return suggestions[i].ID < suggestions[j].ID
+	})
+	if len(suggestions) > MAX_SUGGESTIONS {
+		suggestions = suggestions[:MAX_SUGGESTIONS]
+	}
+	return suggestions, nil
+}
+
+// filterSuggestions убирает тех, с кем с момента расчета появилась дружба, заявка или блокировка,
+// и скрытые рекомендации. Читает мастер, чтобы изменения применялись сразу
+func filterSuggestions(ctx context.Context, userID int64, suggestions []Suggestion) ([]Suggestion, error) {
+	if len(suggestions) == 0 {
+		return suggestions, nil
+	}
+	ids := make([]int64, len(suggestions))
+	for i, s := range suggestions {
+		ids[i] = s.ID
+	}
+	writeDB := db.GetWriteDB(ctx)
+	var hidden []int64
+	var related []int64
+	err := writeDB.Model(&models.Friend{}).
+		Select("CASE WHEN user_id = ? THEN friend_id ELSE user_id END", userID).
+		Where("(user_id = ? AND friend_id IN ?) OR (friend_id = ? AND user_id IN ?)", userID, ids, userID, ids).
+		Scan(&related).Error
+	if err != nil {
+		return nil, err
+	}
+	hidden = append(hidden, related...)
+	related = nil
+	err = writeDB.Model(&models.UserBlock{}).
+		Select("CASE WHEN user_id = ? THEN blocked_id ELSE user_id END", userID).
+		Where("(user_id = ? AND blocked_id IN ?) OR (blocked_id = ? AND user_id IN ?)", userID, ids, userID, ids).
+		Scan(&related).Error
+	if err != nil {
+		return nil, err
+	}
+	hidden = append(hidden, related...)
+	related = nil
+	err = writeDB.Model(&models.SuggestionDismissal{}).
+		Where("user_id = ? AND dismissed_id IN ?", userID, ids).
+		Pluck("dismissed_id", &related).Error
+	if err != nil {
+		return nil, err
+	}
+	hidden = append(hidden, related...)
+	if len(hidden) == 0 {
+		return suggestions, nil
+	}
+
+	skip := make(map[int64]bool, len(hidden))
+	for _, id := range hidden {
+		skip[id] = true
+	}
+	kept := make([]Suggestion, 0, len(suggestions))
+	for _, s := range suggestions {
+		if !skip[s.ID] {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"social/config"
+	"social/db"
+	"social/models"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrTokenReused = errors.New("refresh token reuse detected")
+
+// AccessClaims - полезная нагрузка access-токена (JWT, HS256)
+type AccessClaims struct {
+	UserID    int64  `json:"uid"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenPair - пара токенов, выдаваемая при логине и обновлении
+type TokenPair struct {
+	SessionID        string `json:"session_id"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+var (
+	jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+	generatedSecret     []byte
+	generatedSecretOnce sync.Once
+)
+
+// accessTokenSecret возвращает ключ подписи access-токенов.
+// Если ключ не задан в конфиге, генерируется случайный - токены не переживут рестарт
+// и не будут приниматься другими инстансами
+func accessTokenSecret() []byte {
+	if secret := config.GetAuthConfig().AccessTokenSecret; secret != "" {
+		return []byte(secret)
+	}
+	generatedSecretOnce.Do(func() {
+		generatedSecret = make([]byte, 32)
+		if _, err := rand.Read(generatedSecret); err != nil {
+			panic("failed to generate access token secret: " + err.Error())
+		}
+		log.Println("WARNING: auth.access_token_secret is not set, using random secret")
+	})
+	return generatedSecret
+}
+
+// randomToken генерирует случайную строку из n байт в hex
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken - в БД хранится только хеш refresh-токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func signJWT(signingInput string) string {
+	mac := hmac.New(sha256.New, accessTokenSecret())
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueAccessToken выпускает подписанный access-токен для сессии
+func issueAccessToken(userID int64, sessionID string) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Duration(config.GetAuthConfig().AccessTokenTTL) * time.Second).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + signJWT(signingInput), nil
+}
+
+// parseAccessToken проверяет подпись и срок действия access-токена
+func parseAccessToken(token string) (*AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+	expected := signJWT(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID <= 0 || claims.SessionID == "" || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// IssueTokenPair открывает новую сессию для устройства и выдает к ней пару токенов
+func IssueTokenPair(ctx context.Context, userID int64, device *DeviceInfo) (*TokenPair, error) {
+	var pair *TokenPair
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		sessionID, err := createSession(tx, userID, device)
+		if err != nil {
+			return err
+		}
+		pair, err = issueTokenPair(tx, userID, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Прогреваем кеш, чтобы первый запрос не зависел от лага реплики
+	cacheSession(ctx, pair.SessionID, userID)
+	return pair, nil
+}
+
+func issueTokenPair(tx *gorm.DB, userID int64, familyID string) (*TokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	authConf := config.GetAuthConfig()
+	err = tx.Create(&models.UserTokens{
+		UserID:    userID,
+		Token:     hashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(time.Duration(authConf.RefreshTokenTTL) * time.Second),
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	accessToken, err := issueAccessToken(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		SessionID:        familyID,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(authConf.AccessTokenTTL),
+		RefreshExpiresIn: int64(authConf.RefreshTokenTTL),
+	}, nil
+}
+
+// RefreshTokens обменивает refresh-токен на новую пару (ротация).
+// Повторное предъявление уже использованного токена считается кражей -
+// отзывается вся цепочка токенов этого входа
+func RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var pair *TokenPair
+	var userID int64
+	var reusedFamily string
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		var stored models.UserTokens
+		err := tx.Where("token = ?", hashToken(refreshToken)).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if stored.RevokedAt != nil {
+			reusedFamily = stored.FamilyID
+			return ErrTokenReused
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return ErrInvalidToken
+		}
+
+		// Помечаем токен использованным; условие на revoked_at защищает от гонки двух обновлений
+		result := tx.Model(&models.UserTokens{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reusedFamily = stored.FamilyID
+			return ErrTokenReused
+		}
+
+		userID = stored.UserID
+		if pair, err = issueTokenPair(tx, stored.UserID, stored.FamilyID); err != nil {
+			return err
+		}
+		return touchSession(tx, stored.FamilyID)
+	})
+
+	if errors.Is(err, ErrTokenReused) {
+		log.Printf("AUTH: refresh token reuse detected, revoking family %s", reusedFamily)
+		if revokeErr := RevokeTokenFamily(ctx, reusedFamily); revokeErr != nil {
+			log.Printf("AUTH: failed to revoke family %s: %v", reusedFamily, revokeErr)
+		}
+		return nil, ErrTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	cacheSession(ctx, pair.SessionID, userID)
+	return pair, nil
+}
+
+// RevokeTokenFamily отзывает все refresh-токены цепочки вместе с сессией и сбрасывает кеш
+func RevokeTokenFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	err := db.GetWriteDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserTokens{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.UserSession{}).
+			Where("id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	invalidateSessions(ctx, []string{familyID})
+	return nil
+}
@@ -2,17 +2,15 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
+	"log"
 	"social/db"
 	"social/models"
-	"strings"
 	"time"
-
-	"golang.org/x/crypto/argon2"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserExtra struct {
 	Firstname *string    `json:"first_name"`
 	Lastname  *string    `json:"last_name"`
@@ -26,6 +24,7 @@ type UserHandler struct {
 	Password *string
 	Token    *string
 	Extra    *UserExtra
+	Device   *DeviceInfo
 
 	DbModel *models.User
 }
@@ -37,8 +36,9 @@ func (h *UserHandler) Register() (userId *int64, err error) {
 	}
 
 	ctx := context.Background()
-	// Проверяем, существует ли пользователь с таким никнеймом (read-only операция)
-	err = db.GetReadOnlyDB(ctx).Model(&models.User{}).Where("nickname = ?", *h.Nickname).Count(&alreadyExists).Error
+	// Проверяем, существует ли пользователь с таким никнеймом (read-only операция).
+	// Никнейм удаленного, но еще не очищенного аккаунта тоже занят: аккаунт можно восстановить
+	err = db.GetReadOnlyDB(ctx).Unscoped().Model(&models.User{}).Where("nickname = ?", *h.Nickname).Count(&alreadyExists).Error
 	if err != nil {
 		return nil, err
 	}
@@ -46,14 +46,14 @@ func (h *UserHandler) Register() (userId *int64, err error) {
 		return nil, errors.New("user already exists")
 	}
 
-	salt := make([]byte, 16)
-	if _, err = rand.Read(salt); err != nil {
+	passwordHash, err := hashPassword(h.DbModel.Password)
+	if err != nil {
 		return nil, err
 	}
-
-	hash := argon2.IDKey([]byte(h.DbModel.Password), salt, 1, 64*1024, 4, 32)
-	passwordHash := hex.EncodeToString(salt) + "$" + hex.EncodeToString(hash)
 	h.DbModel.Password = passwordHash
+	if h.DbModel.Role == "" {
+		h.DbModel.Role = models.RoleUser
+	}
 
 	// Запись в мастер
 	trx := db.GetWriteDB(ctx).Model(&models.User{}).Create(&h.DbModel)
@@ -89,56 +89,94 @@ func (h *UserHandler) CheckToken() (err error) {
 	return nil
 }
 
-func (h *UserHandler) Login() (token string, err error) {
+func (h *UserHandler) Login() (tokens *TokenPair, err error) {
 	ctx := context.Background()
 	// Получаем пользователя из БД (read-only операция)
 	var storedUser *models.User
 	err = db.GetReadOnlyDB(ctx).Model(&models.User{}).Where("nickname = ?", h.Nickname).First(&storedUser).Error
 	if err != nil {
-		return "", errors.New("invalid nickname")
+		return nil, errors.New("invalid nickname")
 	}
 	// Проверяем пароль
-	parts := strings.Split(storedUser.Password, "$")
-	if len(parts) != 2 {
-		return "", errors.New("invalid password format")
-	}
-	storedSalt, err := hex.DecodeString(parts[0])
+	ok, needsRehash, err := verifyPassword(*h.Password, storedUser.Password)
 	if err != nil {
-		return "", err
-	}
-	storedHash := parts[1]
-	hash := argon2.IDKey([]byte(*h.Password), storedSalt, 1, 64*1024, 4, 32)
-	if hex.EncodeToString(hash) != storedHash {
-		return "", errors.New("invalid password")
-	}
-
-	// Удаляем старые токены (если они есть)
-	_ = h.Logout()
-	// Генерируем новый токен
-	tokenBytes := make([]byte, 32)
-	if _, err = rand.Read(tokenBytes); err != nil {
-		return "", err
-	}
-	token = hex.EncodeToString(tokenBytes)
-	// Запись токена в мастер
-	err = db.GetWriteDB(ctx).Model(&models.UserTokens{}).Create(&models.UserTokens{
-		UserID: storedUser.ID,
-		Token:  token,
-	}).Error
-	return token, err
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+	// Хеш в старом формате или с устаревшими параметрами незаметно для пользователя пересчитываем
+	if needsRehash {
+		if err := setPassword(db.GetWriteDB(ctx), storedUser.ID, *h.Password); err != nil {
+			log.Printf("PASSWORD: failed to rehash password for user %d: %v", storedUser.ID, err)
+		}
+	}
+
+	// Открываем новую сессию для устройства, остальные сессии пользователя не трогаем (запись в мастер)
+	return IssueTokenPair(ctx, storedUser.ID, h.Device)
 }
 
-func (h *UserHandler) Logout() (err error) {
+// Update частично обновляет профиль пользователя h.DbModel.ID полями из h.Extra (запись в мастер).
+// Если изменилось имя, публикуется событие об изменении профиля для обновления кешей постов
+func (h *UserHandler) Update() (*models.User, error) {
+	if h.DbModel == nil || h.DbModel.ID == 0 {
+		return nil, ErrUserNotFound
+	}
 	ctx := context.Background()
-	var userId int64
-	// Чтение для получения ID (read-only)
-	db.GetReadOnlyDB(ctx).Model(&models.User{}).Select("id").Where("nickname = ?", h.Nickname).First(&userId)
-	// Удаление токена (запись в мастер)
-	err = db.GetWriteDB(ctx).Table("user_tokens").Where("user_id = ?", userId).Delete(&models.UserTokens{}).Error
-	if err != nil {
-		return err
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	nameChanged := false
+	if h.Extra != nil {
+		if h.Extra.Firstname != nil {
+			updates["first_name"] = *h.Extra.Firstname
+			nameChanged = true
+		}
+		if h.Extra.Lastname != nil {
+			updates["last_name"] = *h.Extra.Lastname
+			nameChanged = true
+		}
+		if h.Extra.Birthday != nil {
+			updates["birthday"] = *h.Extra.Birthday
+		}
+		if h.Extra.Sex != nil {
+			updates["sex"] = *h.Extra.Sex
+		}
+		if h.Extra.City != nil {
+			updates["city"] = *h.Extra.City
+		}
+	}
+
+	result := db.GetWriteDB(ctx).Model(&models.User{}).Where("id = ?", h.DbModel.ID).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	// Перечитываем из мастера, чтобы вернуть актуальные данные без лага реплики
+	var user models.User
+	if err := db.GetWriteDB(ctx).Where("id = ?", h.DbModel.ID).First(&user).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	h.DbModel = &user
+
+	if nameChanged {
+		EmitProfileChanged(ctx, user.ID)
+	}
+	return &user, nil
+}
+
+// EmitProfileChanged публикует событие об изменении профиля: закешированные посты автора
+// (FeedPost.UserName и UserAvatar в post:*) обновляются воркером очереди или, без очереди, в фоне
+func EmitProfileChanged(ctx context.Context, userID int64) {
+	if QueueServiceInstance != nil && RedisClient != nil {
+		if err := QueueServiceInstance.EnqueueFeedUpdate(ctx, userID, models.Post{}, "profile_updated"); err == nil {
+			return
+		}
+		log.Printf("PROFILE: failed to enqueue profile update for user %d, refreshing in background", userID)
+	}
+	go NewPostService().refreshAuthorInPostCache(context.Background(), userID)
 }
 
 // GetUser получает пользователя по ID (read-only операция)
@@ -150,19 +188,3 @@ func GetUser(ctx context.Context, userID int64) (*models.User, error) {
 	}
 	return &user, nil
 }
-
-// SearchUsers ищет пользователей по имени и фамилии (read-only операция)
-func SearchUsers(ctx context.Context, firstName, lastName string, limit, offset int) ([]models.User, error) {
-	var users []models.User
-	query := db.GetReadOnlyDB(ctx).Model(&models.User{})
-
-	if firstName != "" {
-		query = query.Where("first_name ILIKE ?", firstName+"%")
-	}
-	if lastName != "" {
-		query = query.Where("last_name ILIKE ?", lastName+"%")
-	}
-
-	err := query.Order("id").Limit(limit).Offset(offset).Find(&users).Error
-	return users, err
-}
@@ -17,16 +17,22 @@ func NewWSConnManager() *WSConnManager {
 	}
 }
 
-func (m *WSConnManager) Add(userID int64, conn *websocket.Conn) {
+// Add регистрирует подключение и сообщает, первое ли это подключение пользователя на инстансе
+func (m *WSConnManager) Add(userID int64, conn *websocket.Conn) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.users[userID] = append(m.users[userID], conn)
+	return len(m.users[userID]) == 1
 }
 
-func (m *WSConnManager) Remove(userID int64, conn *websocket.Conn) {
+// Remove убирает подключение и сообщает, было ли оно последним подключением пользователя на инстансе
+func (m *WSConnManager) Remove(userID int64, conn *websocket.Conn) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	conns := m.users[userID]
+	conns, ok := m.users[userID]
+	if !ok {
+		return false
+	}
 	for i, c := range conns {
 		if c == conn {
 			m.users[userID] = append(conns[:i], conns[i+1:]...)
@@ -35,7 +41,27 @@ func (m *WSConnManager) Remove(userID int64, conn *websocket.Conn) {
 	}
 	if len(m.users[userID]) == 0 {
 		delete(m.users, userID)
+		return true
+	}
+	return false
+}
+
+// IsOnline проверяет, есть ли у пользователя подключения к этому инстансу
+func (m *WSConnManager) IsOnline(userID int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.users[userID]) > 0
+}
+
+// OnlineUserIDs возвращает пользователей, подключенных к этому инстансу
+func (m *WSConnManager) OnlineUserIDs() []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	userIDs := make([]int64, 0, len(m.users))
+	for userID := range m.users {
+		userIDs = append(userIDs, userID)
 	}
+	return userIDs
 }
 
 func (m *WSConnManager) Send(userID int64, message []byte) {
@@ -24,7 +24,7 @@ func setupTestDB() error {
 	}
 
 	// Автомиграция моделей
-	err = database.AutoMigrate(&models.User{}, &models.Friend{})
+	err = database.AutoMigrate(&models.User{}, &models.Friend{}, &models.PrivacySettings{}, &models.UserBlock{})
 	if err != nil {
 		return err
 	}
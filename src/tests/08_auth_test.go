@@ -0,0 +1,275 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuthTestDB(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	require.NoError(t, db.ORM.AutoMigrate(&models.UserTokens{}, &models.UserSession{}))
+}
+
+func setupAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(services.ResolveToken))
+	r.GET("/me", func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	})
+	return r
+}
+
+func TestAuthMiddlewareValidToken(t *testing.T) {
+	setupAuthTestDB(t)
+	r := setupAuthRouter()
+
+	userID, _ := CreateTestUser(t, "Auth", "Valid")
+	tokens, err := services.IssueTokenPair(context.Background(), userID, nil)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	resolved, sessionID, err := services.ResolveToken(context.Background(), tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, resolved)
+	assert.Equal(t, tokens.SessionID, sessionID)
+}
+
+func TestAuthMiddlewareRejectsRevokedSession(t *testing.T) {
+	setupAuthTestDB(t)
+	r := setupAuthRouter()
+
+	userID, _ := CreateTestUser(t, "Auth", "Revoked")
+	tokens, err := services.IssueTokenPair(context.Background(), userID, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.RevokeTokenFamily(context.Background(), tokens.SessionID))
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthMiddlewareRejectsUnknownToken(t *testing.T) {
+	setupAuthTestDB(t)
+	r := setupAuthRouter()
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer unknown_token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthMiddlewareIgnoresTestHeaders(t *testing.T) {
+	setupAuthTestDB(t)
+	r := setupAuthRouter()
+
+	// X-User-ID и test_token_N принимает только TestAuthMiddleware
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-User-ID", "1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer test_token_1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthMiddlewareWebSocketTokenProtocol(t *testing.T) {
+	setupAuthTestDB(t)
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws/feed", middleware.AuthMiddleware(services.ResolveToken), handlers.WSFeedHandler)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	url := "ws" + server.URL[4:] + "/ws/feed"
+
+	userID, _ := CreateTestUser(t, "Auth", "Socket")
+	tokens, err := services.IssueTokenPair(context.Background(), userID, nil)
+	require.NoError(t, err)
+
+	dialer := websocket.Dialer{Subprotocols: []string{middleware.WSTokenProtocol, tokens.AccessToken}}
+	conn, resp, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	// Сервер подтверждает только имя подпротокола, сам токен в ответ не попадает
+	assert.Equal(t, middleware.WSTokenProtocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	// Токен в URL оказался бы в логах запросов, поэтому не принимается
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?token="+tokens.AccessToken, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "Refresh")
+	first, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+
+	second, err := services.RefreshTokens(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, first.SessionID, second.SessionID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, _, err = services.ResolveToken(ctx, second.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "Reuse")
+	first, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+	second, err := services.RefreshTokens(ctx, first.RefreshToken)
+	require.NoError(t, err)
+
+	// Повторное использование старого токена отзывает всю цепочку
+	_, err = services.RefreshTokens(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, services.ErrTokenReused)
+
+	_, err = services.RefreshTokens(ctx, second.RefreshToken)
+	assert.Error(t, err)
+	_, _, err = services.ResolveToken(ctx, second.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestLoginKeepsOtherDeviceSessions(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "Devices")
+	laptop, err := services.IssueTokenPair(ctx, userID, &services.DeviceInfo{DeviceName: "laptop", IP: "10.0.0.1"})
+	require.NoError(t, err)
+	phone, err := services.IssueTokenPair(ctx, userID, &services.DeviceInfo{DeviceName: "phone", UserAgent: "TestPhone/1.0"})
+	require.NoError(t, err)
+
+	// Вход с телефона не разлогинивает ноутбук
+	_, _, err = services.ResolveToken(ctx, laptop.AccessToken)
+	assert.NoError(t, err)
+	_, _, err = services.ResolveToken(ctx, phone.AccessToken)
+	assert.NoError(t, err)
+
+	sessions, err := services.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	devices := map[string]string{}
+	for _, session := range sessions {
+		devices[session.ID] = session.DeviceName
+	}
+	assert.Equal(t, "laptop", devices[laptop.SessionID])
+	assert.Equal(t, "phone", devices[phone.SessionID])
+}
+
+func TestRevokeSession(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "RevokeOne")
+	otherID, _ := CreateTestUser(t, "Auth", "Stranger")
+	first, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+	second, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+
+	// Чужую сессию завершить нельзя
+	assert.ErrorIs(t, services.RevokeSession(ctx, otherID, first.SessionID), services.ErrSessionNotFound)
+
+	require.NoError(t, services.RevokeSession(ctx, userID, first.SessionID))
+	_, _, err = services.ResolveToken(ctx, first.AccessToken)
+	assert.Error(t, err)
+	_, err = services.RefreshTokens(ctx, first.RefreshToken)
+	assert.Error(t, err)
+	_, _, err = services.ResolveToken(ctx, second.AccessToken)
+	assert.NoError(t, err)
+
+	sessions, err := services.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, second.SessionID, sessions[0].ID)
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "RevokeOthers")
+	current, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+	var others []*services.TokenPair
+	for i := 0; i < 2; i++ {
+		pair, err := services.IssueTokenPair(ctx, userID, nil)
+		require.NoError(t, err)
+		others = append(others, pair)
+	}
+
+	revoked, err := services.RevokeOtherSessions(ctx, userID, current.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+
+	_, _, err = services.ResolveToken(ctx, current.AccessToken)
+	assert.NoError(t, err)
+	for _, pair := range others {
+		_, _, err = services.ResolveToken(ctx, pair.AccessToken)
+		assert.Error(t, err)
+	}
+}
+
+func TestLogoutEndsOnlyPresentedSession(t *testing.T) {
+	setupAuthTestDB(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Auth", "Logout")
+	laptop, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+	phone, err := services.IssueTokenPair(ctx, userID, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/logout", middleware.AuthMiddleware(services.ResolveToken), handlers.Logout)
+
+	req, _ := http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+phone.AccessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, _, err = services.ResolveToken(ctx, phone.AccessToken)
+	assert.Error(t, err)
+	_, _, err = services.ResolveToken(ctx, laptop.AccessToken)
+	assert.NoError(t, err)
+}
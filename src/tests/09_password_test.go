@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+)
+
+// captureMailer сохраняет отправленные письма в памяти
+type captureMailer struct {
+	messages []services.MailMessage
+}
+
+func (m *captureMailer) Send(ctx context.Context, msg services.MailMessage) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var resetCodeRe = regexp.MustCompile(`reset code: ([0-9a-f]+)`)
+
+func setupPasswordTestDB(t *testing.T) *captureMailer {
+	require.NoError(t, SetupFeedTestDB())
+	require.NoError(t, db.ORM.AutoMigrate(&models.UserTokens{}, &models.UserSession{}, &models.PasswordReset{}))
+
+	mailer := &captureMailer{}
+	services.MailerInstance = mailer
+	t.Cleanup(func() { services.MailerInstance = nil })
+	return mailer
+}
+
+func registerUserWithPassword(t *testing.T, password, email string) int64 {
+	nickname := fmt.Sprintf("pwd_user_%d", time.Now().UnixNano())
+	handler := services.UserHandler{
+		Nickname: &nickname,
+		Password: &password,
+		DbModel: &models.User{
+			Nickname: nickname,
+			Password: password,
+			Email:    email,
+			Sex:      models.MALE,
+			City:     "Test City",
+		},
+	}
+	userID, err := handler.Register()
+	require.NoError(t, err)
+	return *userID
+}
+
+func loginAs(t *testing.T, userID int64, password string) (*services.TokenPair, error) {
+	var user models.User
+	require.NoError(t, db.ORM.First(&user, userID).Error)
+	handler := services.UserHandler{Nickname: &user.Nickname, Password: &password}
+	return handler.Login()
+}
+
+func TestChangePassword(t *testing.T) {
+	setupPasswordTestDB(t)
+	ctx := context.Background()
+
+	userID := registerUserWithPassword(t, "old-secret", "")
+	current, err := loginAs(t, userID, "old-secret")
+	require.NoError(t, err)
+	other, err := loginAs(t, userID, "old-secret")
+	require.NoError(t, err)
+
+	err = services.ChangePassword(ctx, userID, current.SessionID, "wrong", "new-secret")
+	assert.ErrorIs(t, err, services.ErrInvalidPassword)
+
+	require.NoError(t, services.ChangePassword(ctx, userID, current.SessionID, "old-secret", "new-secret"))
+
+	// Текущая сессия остается, остальные завершаются
+	_, _, err = services.ResolveToken(ctx, current.AccessToken)
+	assert.NoError(t, err)
+	_, _, err = services.ResolveToken(ctx, other.AccessToken)
+	assert.Error(t, err)
+
+	_, err = loginAs(t, userID, "old-secret")
+	assert.Error(t, err)
+	_, err = loginAs(t, userID, "new-secret")
+	assert.NoError(t, err)
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	mailer := setupPasswordTestDB(t)
+	ctx := context.Background()
+
+	userID := registerUserWithPassword(t, "forgotten", "reset@example.com")
+	session, err := loginAs(t, userID, "forgotten")
+	require.NoError(t, err)
+
+	require.NoError(t, services.RequestPasswordReset(ctx, "reset@example.com"))
+	require.Len(t, mailer.messages, 1)
+	assert.Equal(t, "reset@example.com", mailer.messages[0].To)
+	match := resetCodeRe.FindStringSubmatch(mailer.messages[0].Body)
+	require.Len(t, match, 2)
+	code := match[1]
+
+	// Код хранится только в виде хеша
+	var reset models.PasswordReset
+	require.NoError(t, db.ORM.Where("user_id = ?", userID).First(&reset).Error)
+	assert.NotEqual(t, code, reset.CodeHash)
+
+	require.NoError(t, services.ResetPassword(ctx, code, "recovered"))
+	_, err = loginAs(t, userID, "recovered")
+	assert.NoError(t, err)
+
+	// Сброс завершает все сессии, код одноразовый
+	_, _, err = services.ResolveToken(ctx, session.AccessToken)
+	assert.Error(t, err)
+	assert.ErrorIs(t, services.ResetPassword(ctx, code, "again"), services.ErrInvalidResetCode)
+}
+
+func TestPasswordResetCodeExpires(t *testing.T) {
+	mailer := setupPasswordTestDB(t)
+	ctx := context.Background()
+
+	userID := registerUserWithPassword(t, "secret", "expired@example.com")
+	require.NoError(t, services.RequestPasswordReset(ctx, "expired@example.com"))
+	require.Len(t, mailer.messages, 1)
+	code := resetCodeRe.FindStringSubmatch(mailer.messages[0].Body)[1]
+
+	require.NoError(t, db.ORM.Model(&models.PasswordReset{}).Where("user_id = ?", userID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	assert.ErrorIs(t, services.ResetPassword(ctx, code, "new-secret"), services.ErrInvalidResetCode)
+}
+
+func TestPasswordResetCooldown(t *testing.T) {
+	mailer := setupPasswordTestDB(t)
+	ctx := context.Background()
+
+	userID := registerUserWithPassword(t, "secret", "cooldown@example.com")
+	require.NoError(t, services.RequestPasswordReset(ctx, "cooldown@example.com"))
+	require.Len(t, mailer.messages, 1)
+	code := resetCodeRe.FindStringSubmatch(mailer.messages[0].Body)[1]
+
+	// Повторные запросы не отправляют писем и не аннулируют выданный код
+	for i := 0; i < 3; i++ {
+		require.NoError(t, services.RequestPasswordReset(ctx, "cooldown@example.com"))
+	}
+	assert.Len(t, mailer.messages, 1)
+
+	// После cooldown выпускается новый код, а предыдущий перестает действовать
+	require.NoError(t, db.ORM.Model(&models.PasswordReset{}).Where("user_id = ?", userID).
+		Update("created_at", time.Now().Add(-time.Hour)).Error)
+	require.NoError(t, services.RequestPasswordReset(ctx, "cooldown@example.com"))
+	require.Len(t, mailer.messages, 2)
+	assert.ErrorIs(t, services.ResetPassword(ctx, code, "new-secret"), services.ErrInvalidResetCode)
+	newCode := resetCodeRe.FindStringSubmatch(mailer.messages[1].Body)[1]
+	require.NoError(t, services.ResetPassword(ctx, newCode, "new-secret"))
+}
+
+func TestPasswordResetUnknownLogin(t *testing.T) {
+	mailer := setupPasswordTestDB(t)
+
+	// Неизвестный логин не раскрывается ошибкой, письмо не отправляется
+	require.NoError(t, services.RequestPasswordReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, mailer.messages)
+}
+
+func TestSinkMailerWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := &services.SinkMailer{From: "test@social.local", Path: path}
+
+	require.NoError(t, mailer.Send(context.Background(), services.MailMessage{
+		To:      "user@example.com",
+		Subject: "Hello",
+		Body:    "Test body",
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: user@example.com")
+	assert.Contains(t, string(data), "Test body")
+}
+
+func storedPassword(t *testing.T, userID int64) string {
+	var user models.User
+	require.NoError(t, db.ORM.Select("password").First(&user, userID).Error)
+	return user.Password
+}
+
+func TestPasswordHashPHCFormat(t *testing.T) {
+	setupPasswordTestDB(t)
+	WithAuthConfig(t, func(auth *config.AuthConfig) {
+		auth.PasswordHash = config.PasswordHashConfig{Memory: 8 * 1024, Iterations: 2, Parallelism: 1}
+	})
+
+	userID := registerUserWithPassword(t, "phc-secret", "")
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=8192,t=2,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, storedPassword(t, userID))
+
+	_, err := loginAs(t, userID, "phc-secret")
+	assert.NoError(t, err)
+	_, err = loginAs(t, userID, "wrong")
+	assert.Error(t, err)
+}
+
+func TestLoginRejectsMalformedHash(t *testing.T) {
+	setupPasswordTestDB(t)
+	userID := registerUserWithPassword(t, "placeholder", "")
+
+	for _, stored := range []string{
+		"$argon2id$v=19$m=65536,t=1,p=1$$",
+		"$argon2id$v=19$m=65536,t=1,p=1$c2FsdHNhbHQ$",
+		"$argon2id$v=19$m=65536,t=1,p=1$$aGFzaGhhc2g",
+		"$argon2id$v=18$m=65536,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=19$m=65536,t=0,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$bcrypt$v=19$m=65536,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"0123$",
+		"$0123",
+		"not-hex$0123",
+	} {
+		require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", userID).Update("password", stored).Error)
+		assert.NotPanics(t, func() {
+			_, err := loginAs(t, userID, "placeholder")
+			assert.Error(t, err, stored)
+		}, stored)
+	}
+}
+
+func TestLoginUpgradesLegacyHash(t *testing.T) {
+	setupPasswordTestDB(t)
+	userID := registerUserWithPassword(t, "placeholder", "")
+
+	// Хеш в старом формате hex(salt)$hex(hash) с параметрами t=1, m=64MB, p=4
+	salt := []byte("0123456789abcdef")
+	legacy := hex.EncodeToString(salt) + "$" + hex.EncodeToString(argon2.IDKey([]byte("legacy-secret"), salt, 1, 64*1024, 4, 32))
+	require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", userID).Update("password", legacy).Error)
+
+	_, err := loginAs(t, userID, "wrong")
+	assert.Error(t, err)
+	assert.Equal(t, legacy, storedPassword(t, userID))
+
+	_, err = loginAs(t, userID, "legacy-secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(storedPassword(t, userID), "$argon2id$"))
+
+	_, err = loginAs(t, userID, "legacy-secret")
+	assert.NoError(t, err)
+}
+
+func TestLoginRehashesOutdatedParams(t *testing.T) {
+	setupPasswordTestDB(t)
+	WithAuthConfig(t, func(auth *config.AuthConfig) {
+		auth.PasswordHash = config.PasswordHashConfig{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	})
+	userID := registerUserWithPassword(t, "tuned-secret", "")
+	assert.Contains(t, storedPassword(t, userID), "m=8192,t=1,p=1")
+
+	WithAuthConfig(t, func(auth *config.AuthConfig) {
+		auth.PasswordHash = config.PasswordHashConfig{Memory: 16 * 1024, Iterations: 2, Parallelism: 1}
+	})
+	_, err := loginAs(t, userID, "tuned-secret")
+	require.NoError(t, err)
+	assert.Contains(t, storedPassword(t, userID), "m=16384,t=2,p=1")
+}
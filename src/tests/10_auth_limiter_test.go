@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/routes"
+	"social/config"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAuthLimiterTest(t *testing.T) {
+	if services.RedisClient == nil {
+		t.Skip("Redis is not available")
+	}
+	WithAuthConfig(t, func(auth *config.AuthConfig) {
+		auth.BruteForce = config.BruteForceConfig{
+			Window:                  60,
+			FreeAttemptsPerNickname: 2,
+			MaxFailuresPerNickname:  4,
+			FreeAttemptsPerIP:       10,
+			MaxFailuresPerIP:        20,
+			BackoffBase:             1,
+			Lockout:                 30,
+		}
+	})
+}
+
+func TestAuthLimiterBackoffAndLockout(t *testing.T) {
+	setupAuthLimiterTest(t)
+	ctx := context.Background()
+	nickname := fmt.Sprintf("limited_%d", time.Now().UnixNano())
+	ip := fmt.Sprintf("198.51.100.%d", time.Now().UnixNano()%250)
+
+	// Первые неудачи не ограничиваются
+	for i := 0; i < 2; i++ {
+		services.RecordAuthFailure(ctx, services.AuthScopeLogin, nickname, ip)
+		assert.Zero(t, services.CheckAuthAttempt(ctx, services.AuthScopeLogin, nickname, ip))
+	}
+
+	// Дальше задержка растет экспоненциально: 1с, затем блокировка на lockout
+	services.RecordAuthFailure(ctx, services.AuthScopeLogin, nickname, ip)
+	retryAfter := services.CheckAuthAttempt(ctx, services.AuthScopeLogin, nickname, ip)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Second, "unexpected backoff %v", retryAfter)
+
+	services.RecordAuthFailure(ctx, services.AuthScopeLogin, nickname, ip)
+	retryAfter = services.CheckAuthAttempt(ctx, services.AuthScopeLogin, nickname, ip)
+	assert.True(t, retryAfter > 20*time.Second, "expected lockout, got %v", retryAfter)
+
+	// Блокировка по никнейму не затрагивает другие никнеймы с того же IP
+	assert.Zero(t, services.CheckAuthAttempt(ctx, services.AuthScopeLogin, nickname+"_other", ip))
+	// И не распространяется на регистрацию
+	assert.Zero(t, services.CheckAuthAttempt(ctx, services.AuthScopeRegister, nickname, ip))
+
+	services.ResetAuthFailures(ctx, services.AuthScopeLogin, nickname)
+	assert.Zero(t, services.CheckAuthAttempt(ctx, services.AuthScopeLogin, nickname, ip))
+}
+
+func TestLoginReturns429WithRetryAfter(t *testing.T) {
+	setupAuthLimiterTest(t)
+	ctx := context.Background()
+	nickname := fmt.Sprintf("locked_%d", time.Now().UnixNano())
+	for i := 0; i < 4; i++ {
+		services.RecordAuthFailure(ctx, services.AuthScopeLogin, nickname, "")
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", handlers.Login)
+
+	body, _ := json.Marshal(handlers.LoginRequest{Nickname: nickname, Password: "guess"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestClientIPIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clientIP := func(trusted []string) string {
+		WithConfig(t, func(conf *config.Config) { conf.Backend.TrustedProxies = trusted })
+		r := gin.New()
+		require.NoError(t, routes.ConfigureTrustedProxies(r))
+		r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = "192.0.2.10:4321"
+		req.Header.Set("X-Forwarded-For", "203.0.113.77")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "192.0.2.10", clientIP(nil))
+	assert.Equal(t, "203.0.113.77", clientIP([]string{"192.0.2.0/24"}))
+}
+
+func TestSpoofedForwardedForDoesNotResetIPCounter(t *testing.T) {
+	setupAuthLimiterTest(t)
+	require.NoError(t, SetupFeedTestDB())
+	WithConfig(t, func(conf *config.Config) { conf.Backend.TrustedProxies = nil })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, routes.ConfigureTrustedProxies(r))
+	r.POST("/login", handlers.Login)
+	remoteAddr := fmt.Sprintf("198.51.100.%d:5555", time.Now().UnixNano()%250)
+	login := func(i int) int {
+		// Каждая попытка - с новым никнеймом и подмененным X-Forwarded-For
+		body, _ := json.Marshal(handlers.LoginRequest{Nickname: fmt.Sprintf("spoof_%d_%d", time.Now().UnixNano(), i), Password: "guess"})
+		req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// FreeAttemptsPerIP = 10: одиннадцатая неудача включает задержку для адреса соединения
+	for i := 0; i < 11; i++ {
+		require.Equal(t, http.StatusUnauthorized, login(i))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login(11))
+}
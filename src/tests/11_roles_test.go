@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/middleware"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRolesRouter(t *testing.T) *gin.Engine {
+	require.NoError(t, SetupFeedTestDB())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/moderate", middleware.RequireRole(services.GetUserRole, models.RoleModerator), ok)
+	r.GET("/admin", middleware.RequireRole(services.GetUserRole, models.RoleAdmin), ok)
+	return r
+}
+
+func requestAs(r *gin.Engine, path string, userID int64) int {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRoleIncludes(t *testing.T) {
+	assert.True(t, models.RoleAdmin.Includes(models.RoleModerator))
+	assert.True(t, models.RoleModerator.Includes(models.RoleUser))
+	assert.False(t, models.RoleModerator.Includes(models.RoleAdmin))
+	assert.False(t, models.RoleUser.Includes(models.RoleModerator))
+	assert.False(t, models.Role("root").Includes(models.RoleUser))
+}
+
+func TestRequireRole(t *testing.T) {
+	r := setupRolesRouter(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Role", "User")
+	moderatorID, _ := CreateTestUser(t, "Role", "Moderator")
+	adminID, _ := CreateTestUser(t, "Role", "Admin")
+	require.NoError(t, services.SetUserRole(ctx, moderatorID, models.RoleModerator))
+	require.NoError(t, services.SetUserRole(ctx, adminID, models.RoleAdmin))
+
+	assert.Equal(t, http.StatusForbidden, requestAs(r, "/moderate", userID))
+	assert.Equal(t, http.StatusForbidden, requestAs(r, "/admin", userID))
+	assert.Equal(t, http.StatusOK, requestAs(r, "/moderate", moderatorID))
+	assert.Equal(t, http.StatusForbidden, requestAs(r, "/admin", moderatorID))
+	assert.Equal(t, http.StatusOK, requestAs(r, "/moderate", adminID))
+	assert.Equal(t, http.StatusOK, requestAs(r, "/admin", adminID))
+
+	// Неизвестный пользователь не получает доступ
+	assert.Equal(t, http.StatusForbidden, requestAs(r, "/moderate", 999999))
+}
+
+func TestSetUserRoleValidation(t *testing.T) {
+	setupRolesRouter(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Role", "Invalid")
+	assert.ErrorIs(t, services.SetUserRole(ctx, userID, models.Role("root")), services.ErrInvalidRole)
+	assert.ErrorIs(t, services.SetUserRole(ctx, 999999, models.RoleAdmin), services.ErrUserNotFound)
+
+	role, err := services.GetUserRole(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, role)
+}
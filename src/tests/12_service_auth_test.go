@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"social/api/middleware"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testServiceSecret = "test-service-secret"
+
+func setupServiceAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.ServiceAuthMiddleware(testServiceSecret, time.Minute, services.ClaimServiceNonce))
+	r.POST("/v1/messages/send", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return r
+}
+
+func signedServiceRequest(t *testing.T, body string, secret string) *http.Request {
+	req, _ := http.NewRequest("POST", "/v1/messages/send", bytes.NewBufferString(body))
+	require.NoError(t, middleware.SignServiceRequest(req, []byte(body), secret))
+	return req
+}
+
+func TestServiceAuthAcceptsSignedRequest(t *testing.T) {
+	r := setupServiceAuthRouter()
+	body := `{"from":1,"to":2,"text":"hi"}`
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, signedServiceRequest(t, body, testServiceSecret))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Обработчик получает исходное тело запроса
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestServiceAuthRejectsUnsignedAndForged(t *testing.T) {
+	r := setupServiceAuthRouter()
+	body := `{"from":1,"to":2,"text":"hi"}`
+
+	req, _ := http.NewRequest("POST", "/v1/messages/send", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Подпись чужим ключом
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, signedServiceRequest(t, body, "wrong-secret"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Подмена отправителя в теле после подписи
+	req = signedServiceRequest(t, body, testServiceSecret)
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"from":3,"to":2,"text":"hi"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServiceAuthRejectsReplayAndStaleRequests(t *testing.T) {
+	r := setupServiceAuthRouter()
+	body := `{"from":1,"to":2,"text":"hi"}`
+
+	req := signedServiceRequest(t, body, testServiceSecret)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Повтор того же запроса
+	replay, _ := http.NewRequest("POST", "/v1/messages/send", bytes.NewBufferString(body))
+	replay.Header = req.Header.Clone()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, replay)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Устаревшая метка времени
+	stale := signedServiceRequest(t, body, testServiceSecret)
+	stale.Header.Set(middleware.ServiceTimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, stale)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
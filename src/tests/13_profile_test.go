@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupProfileRouter(t *testing.T) *gin.Engine {
+	require.NoError(t, SetupFeedTestDB())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.PATCH("/user/me", handlers.UpdateProfile)
+	return r
+}
+
+func patchProfile(r *gin.Engine, userID int64, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", "/user/me", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateProfilePartial(t *testing.T) {
+	r := setupProfileRouter(t)
+	userID, _ := CreateTestUser(t, "Old", "Name")
+
+	var before models.User
+	require.NoError(t, db.ORM.First(&before, userID).Error)
+	time.Sleep(10 * time.Millisecond)
+
+	w := patchProfile(r, userID, `{"first_name": "New", "birthday": "1990-05-17"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var after models.User
+	require.NoError(t, db.ORM.First(&after, userID).Error)
+	assert.Equal(t, "New", after.FirstName)
+	assert.Equal(t, "1990-05-17", after.Birthday.Format("2006-01-02"))
+	// Непереданные поля не меняются
+	assert.Equal(t, before.LastName, after.LastName)
+	assert.Equal(t, before.City, after.City)
+	assert.Equal(t, before.Sex, after.Sex)
+	assert.True(t, after.UpdatedAt.After(before.UpdatedAt))
+
+	var response struct {
+		User models.User `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "New", response.User.FirstName)
+}
+
+func TestUpdateProfileValidation(t *testing.T) {
+	r := setupProfileRouter(t)
+	userID, _ := CreateTestUser(t, "Valid", "User")
+
+	cases := map[string]string{
+		"invalid sex":      `{"sex": "other"}`,
+		"invalid birthday": `{"birthday": "17.05.1990"}`,
+		"empty first name": `{"first_name": "  "}`,
+		"empty city":       `{"city": ""}`,
+	}
+	for name, body := range cases {
+		w := patchProfile(r, userID, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+
+	var user models.User
+	require.NoError(t, db.ORM.First(&user, userID).Error)
+	assert.Equal(t, "Valid", user.FirstName)
+	assert.Equal(t, "Test City", user.City)
+}
+
+func TestUpdateProfileRefreshesCachedPosts(t *testing.T) {
+	if services.RedisClient == nil {
+		t.Skip("Redis is not available")
+	}
+	r := setupProfileRouter(t)
+	ctx := context.Background()
+	userID, _ := CreateTestUser(t, "Cached", "Author")
+
+	post := models.Post{UserID: userID, Content: "cached post", CreatedAt: time.Now()}
+	require.NoError(t, db.ORM.Create(&post).Error)
+	postKey := fmt.Sprintf("%s%d", services.POST_KEY_PREFIX, post.ID)
+	cached, _ := json.Marshal(models.FeedPost{ID: post.ID, UserID: userID, UserName: "Cached Author", Content: post.Content})
+	require.NoError(t, services.RedisClient.Set(ctx, postKey, cached, time.Hour).Err())
+	t.Cleanup(func() { services.RedisClient.Del(ctx, postKey) })
+
+	w := patchProfile(r, userID, `{"first_name": "Renamed"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Eventually(t, func() bool {
+		val, err := services.RedisClient.Get(ctx, postKey).Result()
+		if err != nil {
+			return false
+		}
+		var feedPost models.FeedPost
+		return json.Unmarshal([]byte(val), &feedPost) == nil && feedPost.UserName == "Renamed Author"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// TTL записи сохраняется
+	ttl, err := services.RedisClient.TTL(ctx, postKey).Result()
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl != redis.KeepTTL)
+}
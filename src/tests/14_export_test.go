@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExportTest(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	require.NoError(t, db.ORM.AutoMigrate(&models.DataExport{}, &models.Interest{}, &models.UserInterest{}))
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.ORM.Table(fmt.Sprintf("messages_%d", i)).AutoMigrate(&models.Message{}))
+	}
+
+	dir := t.TempDir()
+	WithConfig(t, func(conf *config.Config) { conf.Export = config.ExportConfig{Dir: dir, TTL: 3600} })
+}
+
+func waitForExport(t *testing.T, userID int64, exportID string) *models.DataExport {
+	var export *models.DataExport
+	require.Eventually(t, func() bool {
+		var err error
+		export, err = services.GetDataExport(context.Background(), userID, exportID)
+		require.NoError(t, err)
+		return export.Status == models.ExportStatusReady || export.Status == models.ExportStatusFailed
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, models.ExportStatusReady, export.Status, export.Error)
+	return export
+}
+
+func readZipJSON(t *testing.T, zr *zip.ReadCloser, name string, v interface{}) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, v))
+		return
+	}
+	t.Fatalf("%s not found in export", name)
+}
+
+func TestDataExportCollectsUserData(t *testing.T) {
+	setupExportTest(t)
+	ctx := context.Background()
+
+	userID, _ := CreateTestUser(t, "Export", "Owner")
+	friendID, _ := CreateTestUser(t, "Export", "Friend")
+	otherID, _ := CreateTestUser(t, "Other", "User")
+	CreateFriendship(t, userID, friendID)
+
+	interest := models.Interest{Name: "hiking"}
+	require.NoError(t, db.ORM.Create(&interest).Error)
+	require.NoError(t, db.ORM.Create(&models.UserInterest{UserID: userID, InterestID: interest.ID}).Error)
+	require.NoError(t, db.ORM.Create(&models.Post{UserID: userID, Content: "my post", CreatedAt: time.Now()}).Error)
+	require.NoError(t, db.ORM.Create(&models.Post{UserID: friendID, Content: "friend post", CreatedAt: time.Now()}).Error)
+
+	// Сообщения в разных шардах, в том числе чужой диалог
+	require.NoError(t, db.ORM.Table("messages_0").Create(&models.Message{FromUserID: userID, ToUserID: friendID, Text: "sent"}).Error)
+	require.NoError(t, db.ORM.Table("messages_1").Create(&models.Message{FromUserID: friendID, ToUserID: userID, Text: "received"}).Error)
+	require.NoError(t, db.ORM.Table("messages_1").Create(&models.Message{FromUserID: friendID, ToUserID: otherID, Text: "not mine"}).Error)
+
+	export, err := services.RequestDataExport(ctx, userID)
+	require.NoError(t, err)
+	export = waitForExport(t, userID, export.ID)
+	assert.NotNil(t, export.ExpiresAt)
+
+	path, err := services.GetDataExportFile(ctx, userID, export.ID)
+	require.NoError(t, err)
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	var profile map[string]interface{}
+	readZipJSON(t, zr, "profile.json", &profile)
+	assert.Equal(t, "Export", profile["first_name"])
+
+	var interests []models.Interest
+	readZipJSON(t, zr, "interests.json", &interests)
+	require.Len(t, interests, 1)
+	assert.Equal(t, "hiking", interests[0].Name)
+
+	var friendships []models.Friend
+	readZipJSON(t, zr, "friendships.json", &friendships)
+	assert.Len(t, friendships, 1)
+
+	var posts []models.Post
+	readZipJSON(t, zr, "posts.json", &posts)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "my post", posts[0].Content)
+
+	var counters map[string]int64
+	readZipJSON(t, zr, "counters.json", &counters)
+
+	var messages []struct {
+		Source string `json:"source"`
+		Text   string `json:"text"`
+	}
+	readZipJSON(t, zr, "messages.json", &messages)
+	texts := map[string]string{}
+	for _, m := range messages {
+		texts[m.Text] = m.Source
+	}
+	assert.Equal(t, map[string]string{"sent": "messages_0", "received": "messages_1"}, texts)
+}
+
+func TestDataExportAccess(t *testing.T) {
+	setupExportTest(t)
+	ctx := context.Background()
+	userID, _ := CreateTestUser(t, "Export", "Owner")
+	strangerID, _ := CreateTestUser(t, "Export", "Stranger")
+
+	export, err := services.RequestDataExport(ctx, userID)
+	require.NoError(t, err)
+	waitForExport(t, userID, export.ID)
+
+	// Чужую выгрузку не видно
+	_, err = services.GetDataExport(ctx, strangerID, export.ID)
+	assert.ErrorIs(t, err, services.ErrExportNotFound)
+	_, err = services.GetDataExportFile(ctx, strangerID, export.ID)
+	assert.ErrorIs(t, err, services.ErrExportNotFound)
+
+	// Истекшая выгрузка недоступна и удаляется очисткой
+	require.NoError(t, db.ORM.Model(&models.DataExport{}).Where("id = ?", export.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = services.GetDataExportFile(ctx, userID, export.ID)
+	assert.ErrorIs(t, err, services.ErrExportExpired)
+
+	services.CleanupDataExports(ctx)
+	_, err = services.GetDataExport(ctx, userID, export.ID)
+	assert.ErrorIs(t, err, services.ErrExportNotFound)
+}
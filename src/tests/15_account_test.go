@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAccountTestDB(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	require.NoError(t, db.ORM.AutoMigrate(&models.UserTokens{}, &models.UserSession{}, &models.PasswordReset{},
+		&models.Interest{}, &models.UserInterest{}, &models.DataExport{}))
+	require.NoError(t, db.ORM.Table("messages_0").AutoMigrate(&models.Message{}))
+	WithConfig(t, func(conf *config.Config) {
+		conf.Account = config.AccountConfig{DeletionGracePeriod: 3600}
+	})
+}
+
+func nicknameOf(t *testing.T, userID int64) string {
+	var user models.User
+	require.NoError(t, db.ORM.Unscoped().First(&user, userID).Error)
+	return user.Nickname
+}
+
+func TestDeleteAccountHidesUser(t *testing.T) {
+	setupAccountTestDB(t)
+	ctx := context.Background()
+	friendService := services.NewFriendService()
+	postService := services.NewPostService()
+
+	userID := registerUserWithPassword(t, "account-secret", "")
+	nickname := nicknameOf(t, userID)
+	friendID, _ := CreateTestUser(t, "Friend", "User")
+	CreateFriendship(t, userID, friendID)
+	_, err := postService.CreatePost(ctx, userID, "post before deletion")
+	require.NoError(t, err)
+	session, err := loginAs(t, userID, "account-secret")
+	require.NoError(t, err)
+
+	friends, err := friendService.GetFriends(friendID, services.FriendListParams{})
+	require.NoError(t, err)
+	require.Len(t, friends.Users, 1)
+	feed, err := postService.GetUserFeed(ctx, friendID, 0, 20)
+	require.NoError(t, err)
+	require.Len(t, feed.Posts, 1)
+
+	_, err = services.DeleteAccount(ctx, userID, "wrong")
+	assert.ErrorIs(t, err, services.ErrInvalidPassword)
+
+	purgeAt, err := services.DeleteAccount(ctx, userID, "account-secret")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), purgeAt, time.Minute)
+
+	// Аккаунт скрыт отовсюду, сессии завершены, войти нельзя
+	_, err = services.GetUser(ctx, userID)
+	assert.Error(t, err)
+	friends, err = friendService.GetFriends(friendID, services.FriendListParams{})
+	require.NoError(t, err)
+	assert.Empty(t, friends.Users)
+	feed, err = postService.GetUserFeed(ctx, friendID, 0, 20)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Posts)
+	_, _, err = services.ResolveToken(ctx, session.AccessToken)
+	assert.Error(t, err)
+	password := "account-secret"
+	_, err = (&services.UserHandler{Nickname: &nickname, Password: &password}).Login()
+	assert.Error(t, err)
+
+	// Никнейм остается занятым до окончательной очистки
+	duplicate := services.UserHandler{Nickname: &nickname, Password: &password,
+		DbModel: &models.User{Nickname: nickname, Password: password, Sex: models.MALE}}
+	_, err = duplicate.Register()
+	assert.Error(t, err)
+
+	// Восстановление возвращает аккаунт
+	assert.ErrorIs(t, services.RestoreAccount(ctx, nickname, "wrong"), services.ErrAccountNotRestorable)
+	require.NoError(t, services.RestoreAccount(ctx, nickname, "account-secret"))
+	_, err = services.GetUser(ctx, userID)
+	assert.NoError(t, err)
+	friends, err = friendService.GetFriends(friendID, services.FriendListParams{})
+	require.NoError(t, err)
+	assert.Len(t, friends.Users, 1)
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	setupAccountTestDB(t)
+	ctx := context.Background()
+
+	userID := registerUserWithPassword(t, "purge-secret", "")
+	friendID, _ := CreateTestUser(t, "Friend", "User")
+	otherID, _ := CreateTestUser(t, "Other", "User")
+	CreateFriendship(t, userID, friendID)
+	require.NoError(t, db.ORM.Create(&models.Post{UserID: userID, Content: "to be purged"}).Error)
+	require.NoError(t, db.ORM.Create(&models.UserInterest{UserID: userID, InterestID: 1}).Error)
+	require.NoError(t, db.ORM.Table("messages_0").Create(&models.Message{FromUserID: userID, ToUserID: friendID, Text: "bye"}).Error)
+	require.NoError(t, db.ORM.Table("messages_0").Create(&models.Message{FromUserID: friendID, ToUserID: otherID, Text: "stays"}).Error)
+	_, err := loginAs(t, userID, "purge-secret")
+	require.NoError(t, err)
+
+	_, err = services.DeleteAccount(ctx, userID, "purge-secret")
+	require.NoError(t, err)
+
+	// В течение срока хранения данные не удаляются
+	assert.Equal(t, 0, services.PurgeDeletedAccounts(ctx))
+
+	require.NoError(t, db.ORM.Unscoped().Model(&models.User{}).Where("id = ?", userID).
+		Update("deleted_at", time.Now().Add(-2*time.Hour)).Error)
+	assert.ErrorIs(t, services.RestoreAccount(ctx, nicknameOf(t, userID), "purge-secret"), services.ErrAccountNotRestorable)
+	assert.Equal(t, 1, services.PurgeDeletedAccounts(ctx))
+
+	count := func(model interface{}, query string, args ...interface{}) int64 {
+		var n int64
+		require.NoError(t, db.ORM.Unscoped().Model(model).Where(query, args...).Count(&n).Error)
+		return n
+	}
+	assert.Zero(t, count(&models.User{}, "id = ?", userID))
+	assert.Zero(t, count(&models.Post{}, "user_id = ?", userID))
+	assert.Zero(t, count(&models.Friend{}, "user_id = ? OR friend_id = ?", userID, userID))
+	assert.Zero(t, count(&models.UserTokens{}, "user_id = ?", userID))
+	assert.Zero(t, count(&models.UserSession{}, "user_id = ?", userID))
+	assert.Zero(t, count(&models.UserInterest{}, "user_id = ?", userID))
+	assert.Zero(t, count(&models.ShardMap{}, "user_id = ?", userID))
+
+	var messages []models.Message
+	require.NoError(t, db.ORM.Table("messages_0").Find(&messages).Error)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "stays", messages[0].Text)
+}
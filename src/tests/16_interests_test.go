@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupInterestsTestDB(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	require.NoError(t, db.ORM.AutoMigrate(&models.Interest{}, &models.UserInterest{}))
+}
+
+func interestNames(interests []models.Interest) []string {
+	names := []string{}
+	for _, interest := range interests {
+		names = append(names, interest.Name)
+	}
+	return names
+}
+
+func TestUserInterestsAddRemove(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+	userID, _ := CreateTestUser(t, "Interest", "Owner")
+
+	interests, err := services.AddUserInterests(ctx, userID, []string{"Hiking", "  board   games ", "hiking"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"board games", "hiking"}, interestNames(interests))
+
+	// Повторное добавление не создает дублей
+	interests, err = services.AddUserInterests(ctx, userID, []string{"HIKING"})
+	require.NoError(t, err)
+	assert.Len(t, interests, 2)
+
+	_, err = services.AddUserInterests(ctx, userID, []string{" "})
+	assert.ErrorIs(t, err, services.ErrInvalidInterest)
+
+	require.NoError(t, services.RemoveUserInterest(ctx, userID, interests[0].ID))
+	assert.ErrorIs(t, services.RemoveUserInterest(ctx, userID, interests[0].ID), services.ErrInterestNotFound)
+	interests, err = services.GetUserInterests(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hiking"}, interestNames(interests))
+
+	// InterestHandler работает поверх тех же таблиц
+	handler := services.InterestHandler{Model: &models.Interest{Name: "Chess"}}
+	require.NoError(t, handler.Create())
+	assert.NotZero(t, handler.Model.ID)
+	require.NoError(t, handler.SetToUser(userID))
+	require.NoError(t, handler.SetToUser(userID))
+	byUser, err := handler.GetByUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chess", "hiking"}, interestNames(*byUser))
+}
+
+func TestListInterestsAutocomplete(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+	first, _ := CreateTestUser(t, "First", "User")
+	second, _ := CreateTestUser(t, "Second", "User")
+	_, err := services.AddUserInterests(ctx, first, []string{"photography", "physics", "music"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, second, []string{"physics"})
+	require.NoError(t, err)
+
+	interests, err := services.ListInterests(ctx, "PH", 10)
+	require.NoError(t, err)
+	// Более популярные интересы идут первыми
+	assert.Equal(t, []string{"physics", "photography"}, interestNames(interests))
+
+	// Спецсимволы LIKE в префиксе экранируются
+	interests, err = services.ListInterests(ctx, "%", 10)
+	require.NoError(t, err)
+	assert.Empty(t, interests)
+}
+
+func TestSearchUsersByInterests(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+	both, _ := CreateTestUser(t, "Both", "Interests")
+	one, _ := CreateTestUser(t, "One", "Interest")
+	none, _ := CreateTestUser(t, "No", "Interests")
+	_, err := services.AddUserInterests(ctx, both, []string{"go", "rust"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, one, []string{"go"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, none, []string{"cooking"})
+	require.NoError(t, err)
+
+	ids := func(users []models.User) []int64 {
+		result := []int64{}
+		for _, u := range users {
+			result = append(result, u.ID)
+		}
+		return result
+	}
+
+	users, err := services.SearchUsersByInterests(ctx, 0, []string{"Go", "rust"}, false, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{both, one}, ids(users))
+
+	users, err = services.SearchUsersByInterests(ctx, 0, []string{"go", "rust"}, true, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{both}, ids(users))
+
+	users, err = services.SearchUsersByInterests(ctx, 0, []string{"go", "rust"}, false, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{one}, ids(users))
+}
+
+func TestUserGetIncludesInterests(t *testing.T) {
+	setupInterestsTestDB(t)
+	userID, _ := CreateTestUser(t, "Profile", "Interests")
+	_, err := services.AddUserInterests(context.Background(), userID, []string{"travel"})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/user/get/:id", handlers.UserGet)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/user/get/%d", userID), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		User handlers.UserInfo `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{"travel"}, response.User.Interests)
+}
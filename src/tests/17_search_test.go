@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSearchUser(t *testing.T, firstName, lastName, city string, sex models.Sex, age int) int64 {
+	userID, _ := CreateTestUser(t, firstName, lastName)
+	require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"city":     city,
+		"sex":      sex,
+		"birthday": time.Now().AddDate(-age, 0, -1),
+	}).Error)
+	return userID
+}
+
+func searchUserIDs(users []models.User) []int64 {
+	ids := []int64{}
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func TestSearchUsersFilters(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+
+	anna := createSearchUser(t, "Anna", "Ivanova", "Moscow", models.FEMALE, 25)
+	anton := createSearchUser(t, "Anton", "Petrov", "Moscow", models.MALE, 35)
+	andrey := createSearchUser(t, "Andrey", "Ivanov", "Kazan", models.MALE, 45)
+	createSearchUser(t, "Boris", "Ivanov", "Moscow", models.MALE, 30)
+	_, err := services.AddUserInterests(ctx, anton, []string{"chess"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, andrey, []string{"chess", "go"})
+	require.NoError(t, err)
+
+	search := func(params services.UserSearchParams) []int64 {
+		result, err := services.SearchUsers(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(result.Users)), result.Total)
+		return searchUserIDs(result.Users)
+	}
+
+	assert.Equal(t, []int64{anna, anton, andrey}, search(services.UserSearchParams{FirstName: "an"}))
+	assert.Equal(t, []int64{anna, anton}, search(services.UserSearchParams{FirstName: "An", City: "moscow"}))
+	assert.Equal(t, []int64{anton, andrey}, search(services.UserSearchParams{FirstName: "an", Sex: models.MALE}))
+	assert.Equal(t, []int64{anton}, search(services.UserSearchParams{FirstName: "an", MinAge: 30, MaxAge: 40}))
+	assert.Equal(t, []int64{anton, andrey}, search(services.UserSearchParams{Interests: []string{"Chess"}}))
+	assert.Equal(t, []int64{andrey}, search(services.UserSearchParams{Interests: []string{"chess", "go"}, MatchAllInterests: true}))
+
+	// Удаленные аккаунты не находятся
+	require.NoError(t, db.ORM.Delete(&models.User{}, anna).Error)
+	assert.Equal(t, []int64{anton, andrey}, search(services.UserSearchParams{FirstName: "an"}))
+
+	_, err = services.SearchUsers(ctx, services.UserSearchParams{MinAge: 40, MaxAge: 30})
+	assert.ErrorIs(t, err, services.ErrInvalidSearchParams)
+}
+
+func TestSearchUsersCursorPagination(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+
+	var expected []int64
+	for i := 0; i < 5; i++ {
+		expected = append(expected, createSearchUser(t, "Paged", "User", "Omsk", models.MALE, 20))
+	}
+
+	var collected []int64
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		result, err := services.SearchUsers(ctx, services.UserSearchParams{FirstName: "paged", Limit: 2, Cursor: cursor})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), result.Total)
+		collected = append(collected, searchUserIDs(result.Users)...)
+		cursor = result.NextCursor
+		if page < 2 {
+			require.NotEmpty(t, cursor)
+		}
+	}
+	assert.Empty(t, cursor)
+	assert.Equal(t, expected, collected)
+
+	_, err := services.SearchUsers(ctx, services.UserSearchParams{FirstName: "paged", Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, services.ErrInvalidCursor)
+}
+
+func TestUserSearchHandler(t *testing.T) {
+	setupInterestsTestDB(t)
+	createSearchUser(t, "Handler", "User", "Perm", models.FEMALE, 28)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/user/search", handlers.UserSearch)
+	get := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/user/search?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("city=perm&sex=female&min_age=18")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Users []handlers.UserInfo `json:"users"`
+		Total int64               `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Users, 1)
+	assert.Equal(t, int64(1), response.Total)
+
+	// Пустой результат - не ошибка
+	w = get("first_name=nobody")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"users": [], "total": 0}`, w.Body.String())
+
+	for _, query := range []string{"", "sex=other", "first_name=a&max_age=-1", "first_name=a&cursor=%21"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+}
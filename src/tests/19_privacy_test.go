@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setPrivacy(t *testing.T, userID int64, update services.PrivacyUpdate) {
+	_, err := services.UpdatePrivacySettings(context.Background(), userID, update)
+	require.NoError(t, err)
+}
+
+func audience(value string) *string {
+	return &value
+}
+
+func TestPrivacyMessaging(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	ownerID, _ := CreateTestUser(t, "Private", "Owner")
+	friendID, _ := CreateTestUser(t, "Close", "Friend")
+	strangerID, _ := CreateTestUser(t, "Random", "Stranger")
+	CreateFriendship(t, ownerID, friendID)
+
+	// По умолчанию писать может любой
+	assert.NoError(t, services.CheckCanMessage(ctx, strangerID, ownerID))
+
+	setPrivacy(t, ownerID, services.PrivacyUpdate{Messages: audience(models.PrivacyFriends)})
+	assert.ErrorIs(t, services.CheckCanMessage(ctx, strangerID, ownerID), services.ErrMessagesNotAllowed)
+	assert.NoError(t, services.CheckCanMessage(ctx, friendID, ownerID))
+
+	setPrivacy(t, ownerID, services.PrivacyUpdate{Messages: audience(models.PrivacyNobody)})
+	assert.ErrorIs(t, services.CheckCanMessage(ctx, friendID, ownerID), services.ErrMessagesNotAllowed)
+
+	// Остальные настройки не сбрасываются частичным изменением
+	settings, err := services.GetPrivacySettings(ctx, ownerID)
+	require.NoError(t, err)
+	assert.Equal(t, models.PrivacyNobody, settings.Messages)
+	assert.Equal(t, models.PrivacyEveryone, settings.Profile)
+
+	_, err = services.UpdatePrivacySettings(ctx, ownerID, services.PrivacyUpdate{Messages: audience(models.PrivacyFriendsOfFriends)})
+	assert.ErrorIs(t, err, services.ErrInvalidPrivacySetting)
+
+	// Публичный обработчик отправки отвечает 403 до обращения к сервису диалогов
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.POST("/dialog/:user_id/send", handlers.SendMessagePublicHandler)
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/dialog/%d/send", ownerID), bytes.NewBufferString(`{"to": 1, "text": "hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", friendID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestPrivacyFriendRequests(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	friendService := services.NewFriendService()
+	ownerID, _ := CreateTestUser(t, "Request", "Owner")
+	mutualID, _ := CreateTestUser(t, "Mutual", "Friend")
+	friendOfFriendID, _ := CreateTestUser(t, "Friend", "OfFriend")
+	strangerID, _ := CreateTestUser(t, "Random", "Stranger")
+	CreateFriendship(t, ownerID, mutualID)
+	CreateFriendship(t, mutualID, friendOfFriendID)
+
+	setPrivacy(t, ownerID, services.PrivacyUpdate{FriendRequests: audience(models.PrivacyNobody)})
+	assert.ErrorIs(t, friendService.AddFriend(friendOfFriendID, ownerID), services.ErrFriendRequestsNotAllowed)
+
+	setPrivacy(t, ownerID, services.PrivacyUpdate{FriendRequests: audience(models.PrivacyFriendsOfFriends)})
+	assert.ErrorIs(t, friendService.AddFriend(strangerID, ownerID), services.ErrFriendRequestsNotAllowed)
+	assert.NoError(t, friendService.AddFriend(friendOfFriendID, ownerID))
+
+	// Собственные исходящие заявки настройки не ограничивают
+	assert.NoError(t, friendService.AddFriend(ownerID, strangerID))
+}
+
+func TestPrivacyProfileAndSearch(t *testing.T) {
+	setupInterestsTestDB(t)
+	ownerID := createSearchUser(t, "Hidden", "Owner", "Samara", models.FEMALE, 30)
+	friendID, _ := CreateTestUser(t, "Close", "Friend")
+	strangerID, _ := CreateTestUser(t, "Random", "Stranger")
+	CreateFriendship(t, ownerID, friendID)
+	setPrivacy(t, ownerID, services.PrivacyUpdate{
+		Profile:  audience(models.PrivacyFriends),
+		Birthday: audience(models.PrivacyNobody),
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.OptionalAuthMiddleware())
+	r.GET("/user/get/:id", handlers.UserGet)
+	get := func(viewerID int64) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/user/get/%d", ownerID), nil)
+		if viewerID != 0 {
+			req.Header.Set("X-User-ID", fmt.Sprintf("%d", viewerID))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, get(0).Code)
+	assert.Equal(t, http.StatusForbidden, get(strangerID).Code)
+	w := get(friendID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		User handlers.UserInfo `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Samara", response.User.City)
+	assert.Empty(t, response.User.Birthday)
+
+	// Поиск по деталям профиля не раскрывает скрытое
+	ctx := context.Background()
+	search := func(params services.UserSearchParams) []int64 {
+		result, err := services.SearchUsers(ctx, params)
+		require.NoError(t, err)
+		return searchUserIDs(result.Users)
+	}
+	assert.Empty(t, search(services.UserSearchParams{City: "samara", ViewerID: strangerID}))
+	assert.Equal(t, []int64{ownerID}, search(services.UserSearchParams{City: "samara", ViewerID: friendID}))
+	assert.Empty(t, search(services.UserSearchParams{City: "samara", MinAge: 18, ViewerID: friendID}))
+	assert.Equal(t, []int64{ownerID}, search(services.UserSearchParams{FirstName: "hidden", ViewerID: strangerID}))
+
+	// По имени находят все, но аватар видит только аудитория профиля
+	require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", ownerID).Update("avatar_id", "owneravatar").Error)
+	avatarFor := func(viewerID int64) string {
+		result, err := services.SearchUsers(ctx, services.UserSearchParams{FirstName: "hidden", ViewerID: viewerID})
+		require.NoError(t, err)
+		require.Len(t, result.Users, 1)
+		return result.Users[0].AvatarID
+	}
+	assert.Empty(t, avatarFor(strangerID))
+	assert.Empty(t, avatarFor(0))
+	assert.Equal(t, "owneravatar", avatarFor(friendID))
+	assert.Equal(t, "owneravatar", avatarFor(ownerID))
+
+	// Закрытый от всех профиль не находится даже по имени
+	setPrivacy(t, ownerID, services.PrivacyUpdate{Profile: audience(models.PrivacyNobody)})
+	assert.Empty(t, search(services.UserSearchParams{FirstName: "hidden", ViewerID: friendID}))
+	assert.Equal(t, []int64{ownerID}, search(services.UserSearchParams{FirstName: "hidden", ViewerID: ownerID}))
+
+	var count int64
+	require.NoError(t, db.ORM.Model(&models.PrivacySettings{}).Where("user_id = ?", ownerID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
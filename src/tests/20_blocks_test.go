@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockRemovesFriendshipAndRestrictsContact(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	friendService := services.NewFriendService()
+	postService := services.NewPostService()
+	userID, _ := CreateTestUser(t, "Block", "Owner")
+	friendID, _ := CreateTestUser(t, "Former", "Friend")
+	requesterID, _ := CreateTestUser(t, "Pending", "Requester")
+	CreateFriendship(t, userID, friendID)
+	require.NoError(t, friendService.AddFriend(requesterID, userID))
+
+	_, err := postService.CreatePost(ctx, friendID, "before block")
+	require.NoError(t, err)
+	feed, err := postService.GetUserFeed(ctx, userID, 0, 20)
+	require.NoError(t, err)
+	require.Len(t, feed.Posts, 1)
+
+	require.NoError(t, services.BlockUser(ctx, userID, friendID))
+	require.NoError(t, services.BlockUser(ctx, userID, requesterID))
+	// Повторная блокировка не ошибка
+	require.NoError(t, services.BlockUser(ctx, userID, friendID))
+	assert.ErrorIs(t, services.BlockUser(ctx, userID, userID), services.ErrCannotBlockSelf)
+	assert.ErrorIs(t, services.BlockUser(ctx, userID, 999999), services.ErrUserNotFound)
+
+	var friendships int64
+	require.NoError(t, db.ORM.Model(&models.Friend{}).
+		Where("user_id IN ? OR friend_id IN ?", []int64{friendID, requesterID}, []int64{friendID, requesterID}).
+		Count(&friendships).Error)
+	assert.Zero(t, friendships)
+
+	feed, err = postService.GetUserFeed(ctx, userID, 0, 20)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Posts)
+
+	// Блокировка действует в обе стороны
+	assert.ErrorIs(t, services.CheckCanMessage(ctx, friendID, userID), services.ErrUserBlocked)
+	assert.ErrorIs(t, services.CheckCanMessage(ctx, userID, friendID), services.ErrUserBlocked)
+	assert.ErrorIs(t, friendService.AddFriend(friendID, userID), services.ErrUserBlocked)
+	assert.ErrorIs(t, friendService.AddFriend(userID, friendID), services.ErrUserBlocked)
+
+	blocked, err := services.ListBlockedUsers(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, blocked, 2)
+	assert.ElementsMatch(t, []int64{friendID, requesterID}, []int64{blocked[0].ID, blocked[1].ID})
+
+	require.NoError(t, services.UnblockUser(ctx, userID, friendID))
+	assert.ErrorIs(t, services.UnblockUser(ctx, userID, friendID), services.ErrBlockNotFound)
+	assert.NoError(t, services.CheckCanMessage(ctx, friendID, userID))
+	// Дружба после разблокировки не восстанавливается
+	ok, err := services.AreFriends(ctx, userID, friendID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBlockHidesFromSearchAndProfile(t *testing.T) {
+	setupInterestsTestDB(t)
+	ctx := context.Background()
+	ownerID := createSearchUser(t, "Blocking", "Owner", "Tver", models.MALE, 25)
+	blockedID := createSearchUser(t, "Blocked", "Viewer", "Tver", models.FEMALE, 25)
+	otherID := createSearchUser(t, "Other", "Viewer", "Tver", models.FEMALE, 25)
+	require.NoError(t, services.BlockUser(ctx, ownerID, blockedID))
+
+	search := func(viewerID int64) []int64 {
+		result, err := services.SearchUsers(ctx, services.UserSearchParams{City: "tver", ViewerID: viewerID})
+		require.NoError(t, err)
+		return searchUserIDs(result.Users)
+	}
+	assert.NotContains(t, search(blockedID), ownerID)
+	assert.Contains(t, search(otherID), ownerID)
+	// Заблокировавший по-прежнему видит заблокированного
+	assert.Contains(t, search(ownerID), blockedID)
+
+	_, err := services.GetProfileAccess(ctx, blockedID, ownerID)
+	assert.ErrorIs(t, err, services.ErrProfileHidden)
+	_, err = services.GetProfileAccess(ctx, otherID, ownerID)
+	assert.NoError(t, err)
+}
+
+func TestBlockHandlers(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	userID, _ := CreateTestUser(t, "Handler", "Owner")
+	targetID, _ := CreateTestUser(t, "Handler", "Target")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.POST("/blocks", handlers.BlockUser)
+	r.DELETE("/blocks/:user_id", handlers.UnblockUser)
+	r.GET("/blocks", handlers.ListBlockedUsers)
+	r.POST("/dialog/:user_id/send", handlers.SendMessagePublicHandler)
+	do := func(method, path, body string, asUser int64) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", asUser))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do("POST", "/blocks", fmt.Sprintf(`{"user_id": %d}`, targetID), userID).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/blocks", fmt.Sprintf(`{"user_id": %d}`, userID), userID).Code)
+
+	w := do("GET", "/blocks", "", userID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Blocked []services.BlockedUser `json:"blocked"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Blocked, 1)
+	assert.Equal(t, targetID, response.Blocked[0].ID)
+
+	// Заблокированный не может писать заблокировавшему
+	w = do("POST", fmt.Sprintf("/dialog/%d/send", userID), `{"to": 1, "text": "hi"}`, targetID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", fmt.Sprintf("/blocks/%d", targetID), "", userID).Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", fmt.Sprintf("/blocks/%d", targetID), "", userID).Code)
+}
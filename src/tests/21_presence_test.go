@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPresenceTest поднимает сервер с ws/feed и user/presence без Redis (присутствие одного инстанса)
+func setupPresenceTest(t *testing.T) *httptest.Server {
+	require.NoError(t, SetupFeedTestDB())
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws/feed", middleware.TestAuthMiddleware(), handlers.WSFeedHandler)
+	r.GET("/user/presence", middleware.OptionalAuthMiddleware(), handlers.GetPresence)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func connectPresenceWS(t *testing.T, server *httptest.Server, userID int64) *websocket.Conn {
+	headers := http.Header{"X-User-ID": []string{strconv.FormatInt(userID, 10)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:]+"/ws/feed", headers)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, _, err = conn.ReadMessage() // приветствие
+	require.NoError(t, err)
+	return conn
+}
+
+func readPresenceEvent(t *testing.T, conn *websocket.Conn) services.PresenceEvent {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var event services.PresenceEvent
+	require.NoError(t, json.Unmarshal(msg, &event))
+	require.Equal(t, "presence", event.Event)
+	return event
+}
+
+func TestPresencePushedToFriends(t *testing.T) {
+	server := setupPresenceTest(t)
+	userID, _ := CreateTestUser(t, "Online", "User")
+	friendID, _ := CreateTestUser(t, "Watching", "Friend")
+	CreateFriendship(t, userID, friendID)
+
+	friendConn := connectPresenceWS(t, server, friendID)
+	first := connectPresenceWS(t, server, userID)
+	event := readPresenceEvent(t, friendConn)
+	assert.Equal(t, userID, event.UserID)
+	assert.True(t, event.Online)
+	assert.True(t, services.GlobalWSConnManager.IsOnline(userID))
+
+	// Второе подключение и его закрытие статус не меняют
+	second := connectPresenceWS(t, server, userID)
+	second.Close()
+	first.Close()
+	event = readPresenceEvent(t, friendConn)
+	assert.Equal(t, userID, event.UserID)
+	assert.False(t, event.Online)
+	assert.False(t, services.GlobalWSConnManager.IsOnline(userID))
+
+	presence, err := services.GetPresence(context.Background(), friendID, []int64{userID})
+	require.NoError(t, err)
+	require.Len(t, presence, 1)
+	assert.False(t, presence[0].Online)
+	require.NotNil(t, presence[0].LastSeen)
+	assert.WithinDuration(t, event.LastSeen, *presence[0].LastSeen, time.Second)
+}
+
+func TestPresenceRespectsPrivacy(t *testing.T) {
+	server := setupPresenceTest(t)
+	ctx := context.Background()
+	publicID, _ := CreateTestUser(t, "Public", "Presence")
+	friendsOnlyID, _ := CreateTestUser(t, "Friends", "Presence")
+	hiddenID, _ := CreateTestUser(t, "Hidden", "Presence")
+	blockerID, _ := CreateTestUser(t, "Blocking", "Presence")
+	viewerID, _ := CreateTestUser(t, "Presence", "Viewer")
+	setPrivacy(t, friendsOnlyID, services.PrivacyUpdate{Presence: audience(models.PrivacyFriends)})
+	setPrivacy(t, hiddenID, services.PrivacyUpdate{Presence: audience(models.PrivacyNobody)})
+	require.NoError(t, services.BlockUser(ctx, blockerID, viewerID))
+
+	connectPresenceWS(t, server, publicID)
+	connectPresenceWS(t, server, friendsOnlyID)
+
+	get := func(viewer int64) []services.Presence {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/user/presence?ids=%d,%d,%d,%d,%d", server.URL,
+			publicID, friendsOnlyID, hiddenID, blockerID, publicID), nil)
+		if viewer != 0 {
+			req.Header.Set("X-User-ID", strconv.FormatInt(viewer, 10))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Presence []services.Presence `json:"presence"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body.Presence
+	}
+	ids := func(presence []services.Presence) []int64 {
+		result := []int64{}
+		for _, p := range presence {
+			result = append(result, p.UserID)
+		}
+		return result
+	}
+
+	anonymous := get(0)
+	assert.Equal(t, []int64{publicID, blockerID}, ids(anonymous))
+	assert.True(t, anonymous[0].Online)
+	assert.False(t, anonymous[1].Online)
+	assert.Equal(t, []int64{publicID}, ids(get(viewerID)))
+
+	CreateFriendship(t, friendsOnlyID, viewerID)
+	withFriend := get(viewerID)
+	assert.Equal(t, []int64{publicID, friendsOnlyID}, ids(withFriend))
+	assert.True(t, withFriend[1].Online)
+
+	// Себя пользователь видит всегда
+	self, err := services.GetPresence(ctx, hiddenID, []int64{hiddenID})
+	require.NoError(t, err)
+	assert.Len(t, self, 1)
+
+	_, err = services.GetPresence(ctx, viewerID, make([]int64, services.MAX_PRESENCE_BATCH+1))
+	assert.ErrorIs(t, err, services.ErrTooManyPresenceIDs)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFriendRequestRejectAndCooldown(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	WithConfig(t, func(conf *config.Config) {
+		conf.Friends.RejectCooldown = 60 * 60
+	})
+	friendService := services.NewFriendService()
+	requesterID, _ := CreateTestUser(t, "Hopeful", "Requester")
+	recipientID, _ := CreateTestUser(t, "Picky", "Recipient")
+
+	require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	assert.ErrorIs(t, friendService.AddFriend(requesterID, recipientID), services.ErrFriendRequestExists)
+	// Отклонить можно только входящую заявку
+	assert.ErrorIs(t, friendService.RejectFriend(requesterID, recipientID), services.ErrFriendRequestNotFound)
+	require.NoError(t, friendService.RejectFriend(recipientID, requesterID))
+	assert.ErrorIs(t, friendService.ApproveFriend(recipientID, requesterID), services.ErrFriendRequestNotFound)
+
+	var friendship models.Friend
+	require.NoError(t, db.ORM.Where("user_id = ? AND friend_id = ?", requesterID, recipientID).First(&friendship).Error)
+	assert.Equal(t, models.FriendStatusRejected, friendship.Status)
+	assert.WithinDuration(t, time.Now(), friendship.RejectedAt, 5*time.Second)
+
+	// Получивший отказ ждет, отказавший может сам отправить заявку сразу
+	assert.ErrorIs(t, friendService.AddFriend(requesterID, recipientID), services.ErrFriendRequestCooldown)
+	require.NoError(t, friendService.AddFriend(recipientID, requesterID))
+	require.NoError(t, friendService.RejectFriend(requesterID, recipientID))
+
+	// По истечении паузы заявку снова можно отправить
+	require.NoError(t, db.ORM.Model(&models.Friend{}).
+		Where("user_id = ? AND friend_id = ?", recipientID, requesterID).
+		Update("rejected_at", time.Now().Add(-2*time.Hour)).Error)
+	require.NoError(t, friendService.AddFriend(recipientID, requesterID))
+	require.NoError(t, friendService.ApproveFriend(requesterID, recipientID))
+
+	var count int64
+	require.NoError(t, db.ORM.Model(&models.Friend{}).
+		Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", requesterID, recipientID, recipientID, requesterID).
+		Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	assert.ErrorIs(t, friendService.AddFriend(requesterID, recipientID), services.ErrAlreadyFriends)
+}
+
+func TestFriendRequestCancelAndOutgoingList(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	friendService := services.NewFriendService()
+	requesterID, _ := CreateTestUser(t, "Outgoing", "Requester")
+	firstID, _ := CreateTestUser(t, "First", "Recipient")
+	secondID, _ := CreateTestUser(t, "Second", "Recipient")
+	thirdID, _ := CreateTestUser(t, "Third", "Recipient")
+	for _, recipientID := range []int64{firstID, secondID, thirdID} {
+		require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	}
+	require.NoError(t, friendService.RejectFriend(secondID, requesterID))
+
+	// Отозвать можно только свою еще не рассмотренную заявку
+	assert.ErrorIs(t, friendService.CancelFriendRequest(firstID, requesterID), services.ErrFriendRequestNotFound)
+	assert.ErrorIs(t, friendService.CancelFriendRequest(requesterID, secondID), services.ErrFriendRequestNotFound)
+	require.NoError(t, friendService.CancelFriendRequest(requesterID, thirdID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.GET("/friends/requests/outgoing", handlers.GetOutgoingRequests)
+	r.POST("/friends/reject", handlers.RejectFriend)
+	get := func(query string) []services.FriendRequest {
+		req, _ := http.NewRequest("GET", "/friends/requests/outgoing"+query, nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", requesterID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Requests []services.FriendRequest `json:"requests"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Requests
+	}
+
+	requests := get("")
+	require.Len(t, requests, 2)
+	statuses := map[int64]services.FriendRequest{}
+	for _, request := range requests {
+		statuses[request.ID] = request
+	}
+	assert.Equal(t, models.FriendStatusPending, statuses[firstID].Status)
+	assert.Nil(t, statuses[firstID].RejectedAt)
+	assert.Equal(t, models.FriendStatusRejected, statuses[secondID].Status)
+	assert.NotNil(t, statuses[secondID].RejectedAt)
+
+	assert.Len(t, get("?limit=1"), 1)
+	assert.Len(t, get("?limit=1&offset=1"), 1)
+	assert.Empty(t, get("?offset=2"))
+
+	req, _ := http.NewRequest("POST", "/friends/reject", bytes.NewBufferString(fmt.Sprintf(`{"friend_id": %d}`, thirdID)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", requesterID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteFriendKeepsRejectCooldown(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	WithConfig(t, func(conf *config.Config) {
+		conf.Friends.RejectCooldown = 60 * 60
+	})
+	friendService := services.NewFriendService()
+	requesterID, _ := CreateTestUser(t, "Persistent", "Requester")
+	recipientID, _ := CreateTestUser(t, "Firm", "Recipient")
+
+	require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	require.NoError(t, friendService.RejectFriend(recipientID, requesterID))
+
+	// Удаление не стирает отказ: повторная заявка все равно ждет паузу
+	require.NoError(t, friendService.DeleteFriend(requesterID, recipientID))
+	assert.ErrorIs(t, friendService.AddFriend(requesterID, recipientID), services.ErrFriendRequestCooldown)
+
+	var friendship models.Friend
+	require.NoError(t, db.ORM.Where("user_id = ? AND friend_id = ?", requesterID, recipientID).First(&friendship).Error)
+	assert.Equal(t, models.FriendStatusRejected, friendship.Status)
+}
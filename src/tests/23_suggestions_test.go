@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func suggestionIDs(suggestions []services.Suggestion) []int64 {
+	ids := []int64{}
+	for _, s := range suggestions {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestSuggestionsRanking(t *testing.T) {
+	setupInterestsTestDB(t)
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+	ctx := context.Background()
+
+	me := createSearchUser(t, "Suggest", "Me", "Moscow", models.MALE, 30)
+	friendA := createSearchUser(t, "Friend", "A", "Kazan", models.MALE, 30)
+	friendB := createSearchUser(t, "Friend", "B", "Kazan", models.MALE, 30)
+	twoMutual := createSearchUser(t, "Two", "Mutual", "Kazan", models.MALE, 30)
+	oneMutual := createSearchUser(t, "One", "Mutual", "Kazan", models.MALE, 30)
+	sameInterest := createSearchUser(t, "Same", "Interest", "Kazan", models.FEMALE, 30)
+	sameCity := createSearchUser(t, "Same", "City", "moscow", models.FEMALE, 30)
+	stranger := createSearchUser(t, "Total", "Stranger", "Omsk", models.FEMALE, 30)
+	pending := createSearchUser(t, "Pending", "Request", "Moscow", models.FEMALE, 30)
+	blocked := createSearchUser(t, "Blocked", "User", "Moscow", models.FEMALE, 30)
+	hidden := createSearchUser(t, "Hidden", "Profile", "Moscow", models.FEMALE, 30)
+	friendsOnly := createSearchUser(t, "Friends", "Only", "Moscow", models.FEMALE, 30)
+
+	CreateFriendship(t, me, friendA)
+	CreateFriendship(t, friendB, me)
+	CreateFriendship(t, friendA, twoMutual)
+	CreateFriendship(t, twoMutual, friendB)
+	CreateFriendship(t, oneMutual, friendA)
+	CreateFriendship(t, friendA, friendsOnly)
+	_, err := services.AddUserInterests(ctx, me, []string{"chess", "go", "poker"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, sameInterest, []string{"chess", "go", "poker"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, stranger, []string{"darts"})
+	require.NoError(t, err)
+	_, err = services.AddUserInterests(ctx, friendsOnly, []string{"chess"})
+	require.NoError(t, err)
+	require.NoError(t, services.NewFriendService().AddFriend(me, pending))
+	require.NoError(t, services.BlockUser(ctx, blocked, me))
+	setPrivacy(t, hidden, services.PrivacyUpdate{Profile: audience(models.PrivacyNobody)})
+	setPrivacy(t, friendsOnly, services.PrivacyUpdate{Profile: audience(models.PrivacyFriends)})
+
+	suggestions, err := services.GetSuggestions(ctx, me, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{twoMutual, sameInterest, oneMutual, friendsOnly, sameCity}, suggestionIDs(suggestions))
+	assert.Equal(t, 2, suggestions[0].MutualFriends)
+	assert.Equal(t, 2*services.MUTUAL_FRIEND_WEIGHT, suggestions[0].Score)
+	assert.Equal(t, 3, suggestions[1].SharedInterests)
+	// Город и интересы скрытого от посторонних профиля не учитываются и не показываются
+	assert.Equal(t, 1, suggestions[3].MutualFriends)
+	assert.Zero(t, suggestions[3].SharedInterests)
+	assert.False(t, suggestions[3].SameCity)
+	assert.Empty(t, suggestions[3].City)
+	assert.True(t, suggestions[4].SameCity)
+	assert.Equal(t, services.SAME_CITY_WEIGHT, suggestions[4].Score)
+
+	limited, err := services.GetSuggestions(ctx, me, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{twoMutual, sameInterest}, suggestionIDs(limited))
+}
+
+func TestSuggestionsDismiss(t *testing.T) {
+	setupInterestsTestDB(t)
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+
+	me := createSearchUser(t, "Dismissing", "User", "Tver", models.MALE, 30)
+	first := createSearchUser(t, "First", "Neighbour", "Tver", models.MALE, 30)
+	second := createSearchUser(t, "Second", "Neighbour", "Tver", models.MALE, 30)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.GET("/friends/suggestions", handlers.GetSuggestions)
+	r.DELETE("/friends/suggestions/:user_id", handlers.DismissSuggestion)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", me))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	get := func() []int64 {
+		w := do("GET", "/friends/suggestions")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Suggestions []services.Suggestion `json:"suggestions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return suggestionIDs(response.Suggestions)
+	}
+
+	assert.ElementsMatch(t, []int64{first, second}, get())
+	assert.Equal(t, http.StatusOK, do("DELETE", fmt.Sprintf("/friends/suggestions/%d", first)).Code)
+	// Повторное скрытие не ошибка
+	assert.Equal(t, http.StatusOK, do("DELETE", fmt.Sprintf("/friends/suggestions/%d", first)).Code)
+	assert.Equal(t, []int64{second}, get())
+
+	assert.Equal(t, http.StatusBadRequest, do("DELETE", fmt.Sprintf("/friends/suggestions/%d", me)).Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/friends/suggestions/999999").Code)
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutualFriends(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	me, _ := CreateTestUser(t, "Mutual", "Me")
+	other, _ := CreateTestUser(t, "Mutual", "Other")
+	alice, _ := CreateTestUser(t, "Alice", "Common")
+	bob, _ := CreateTestUser(t, "Bob", "Common")
+	carol, _ := CreateTestUser(t, "Carol", "Common")
+	onlyMine, _ := CreateTestUser(t, "Only", "Mine")
+	for _, friendID := range []int64{alice, bob, carol, onlyMine} {
+		CreateFriendship(t, me, friendID)
+	}
+	// Дружба хранится в любом направлении; повторная строка пары не удваивает счетчик
+	for _, friendID := range []int64{alice, bob, carol} {
+		CreateFriendship(t, friendID, other)
+	}
+	CreateFriendship(t, other, alice)
+	setPrivacy(t, carol, services.PrivacyUpdate{Profile: audience(models.PrivacyNobody)})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.GET("/friends/mutual/:user_id", handlers.GetMutualFriends)
+	get := func(query string) (int, services.MutualFriends) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/friends/mutual/%d%s", other, query), nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", me))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response services.MutualFriends
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	code, mutual := get("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(3), mutual.Count)
+	require.Len(t, mutual.Friends, 3)
+	assert.Equal(t, []int64{alice, bob, carol}, []int64{mutual.Friends[0].ID, mutual.Friends[1].ID, mutual.Friends[2].ID})
+	assert.Equal(t, "Alice", mutual.Friends[0].FirstName)
+
+	_, page := get("?limit=1&offset=1")
+	assert.Equal(t, int64(3), page.Count)
+	require.Len(t, page.Friends, 1)
+	assert.Equal(t, bob, page.Friends[0].ID)
+
+	// Удаленный аккаунт не считается
+	require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", bob).Update("deleted_at", time.Now()).Error)
+	_, mutual = get("")
+	assert.Equal(t, int64(2), mutual.Count)
+
+	_, err := services.GetMutualFriends(ctx, me, me, 10, 0)
+	assert.ErrorIs(t, err, services.ErrCompareWithSelf)
+	require.NoError(t, services.BlockUser(ctx, other, me))
+	code, _ = get("")
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestFriendshipDegree(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	me, _ := CreateTestUser(t, "Degree", "Me")
+	first, _ := CreateTestUser(t, "Degree", "First")
+	second, _ := CreateTestUser(t, "Degree", "Second")
+	third, _ := CreateTestUser(t, "Degree", "Third")
+	fourth, _ := CreateTestUser(t, "Degree", "Fourth")
+	CreateFriendship(t, me, first)
+	CreateFriendship(t, second, first)
+	CreateFriendship(t, second, third)
+	CreateFriendship(t, fourth, third)
+
+	for expected, userID := range map[int]int64{1: first, 2: second, 3: third, 0: fourth} {
+		degree, err := services.GetFriendshipDegree(ctx, me, userID)
+		require.NoError(t, err)
+		assert.Equal(t, expected, degree, "user %d", userID)
+	}
+
+	// Неподтвержденная заявка связью не считается
+	require.NoError(t, services.NewFriendService().AddFriend(me, fourth))
+	degree, err := services.GetFriendshipDegree(ctx, me, fourth)
+	require.NoError(t, err)
+	assert.Equal(t, 0, degree)
+
+	_, err = services.GetFriendshipDegree(ctx, me, 999999)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowAddsAuthorToFeed(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	postService := services.NewPostService()
+	followerID, _ := CreateTestUser(t, "Loyal", "Follower")
+	authorID, _ := CreateTestUser(t, "Public", "Figure")
+	friendID, _ := CreateTestUser(t, "Close", "Friend")
+	CreateFriendship(t, followerID, friendID)
+
+	_, err := postService.CreatePost(ctx, authorID, "public announcement")
+	require.NoError(t, err)
+	_, err = postService.CreatePost(ctx, friendID, "friend news")
+	require.NoError(t, err)
+	feed, err := postService.GetUserFeed(ctx, followerID, 0, 20)
+	require.NoError(t, err)
+	require.Len(t, feed.Posts, 1)
+
+	require.NoError(t, services.FollowUser(ctx, followerID, authorID))
+	// Повторная подписка не ошибка, подписка на друга не дублирует его посты
+	require.NoError(t, services.FollowUser(ctx, followerID, authorID))
+	require.NoError(t, services.FollowUser(ctx, followerID, friendID))
+	assert.ErrorIs(t, services.FollowUser(ctx, followerID, followerID), services.ErrCannotFollowSelf)
+	assert.ErrorIs(t, services.FollowUser(ctx, followerID, 999999), services.ErrUserNotFound)
+
+	feed, err = postService.GetUserFeed(ctx, followerID, 0, 20)
+	require.NoError(t, err)
+	require.Len(t, feed.Posts, 2)
+	assert.ElementsMatch(t, []int64{authorID, friendID}, []int64{feed.Posts[0].UserID, feed.Posts[1].UserID})
+	// Подписка односторонняя
+	feed, err = postService.GetUserFeed(ctx, authorID, 0, 20)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Posts)
+
+	require.NoError(t, services.UnfollowUser(ctx, followerID, authorID))
+	assert.ErrorIs(t, services.UnfollowUser(ctx, followerID, authorID), services.ErrFollowNotFound)
+	feed, err = postService.GetUserFeed(ctx, followerID, 0, 20)
+	require.NoError(t, err)
+	require.Len(t, feed.Posts, 1)
+	assert.Equal(t, friendID, feed.Posts[0].UserID)
+
+	// Блокировка удаляет подписки и не дает подписаться снова
+	require.NoError(t, services.FollowUser(ctx, followerID, authorID))
+	require.NoError(t, services.BlockUser(ctx, authorID, followerID))
+	following, err := services.ListFollowing(ctx, followerID, followerID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), following.Count)
+	assert.ErrorIs(t, services.FollowUser(ctx, followerID, authorID), services.ErrUserBlocked)
+}
+
+func TestFollowListsAndCounts(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	ctx := context.Background()
+	authorID, _ := CreateTestUser(t, "Famous", "Author")
+	viewerID, _ := CreateTestUser(t, "Curious", "Viewer")
+	var followers []int64
+	for i := 0; i < 3; i++ {
+		followerID, _ := CreateTestUser(t, "Fan", fmt.Sprintf("Number%d", i))
+		require.NoError(t, services.FollowUser(ctx, followerID, authorID))
+		followers = append(followers, followerID)
+	}
+	require.NoError(t, services.FollowUser(ctx, authorID, followers[0]))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.POST("/follows", handlers.FollowUser)
+	r.GET("/follows/:user_id/followers", handlers.ListFollowers)
+	r.GET("/follows/:user_id/following", handlers.ListFollowing)
+	get := func(path string) (int, services.FollowList) {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", viewerID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response services.FollowList
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	code, list := get(fmt.Sprintf("/follows/%d/followers", authorID))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(3), list.Count)
+	require.Len(t, list.Users, 3)
+	// Сначала последние подписчики
+	assert.Equal(t, followers[2], list.Users[0].ID)
+	assert.False(t, list.Users[0].FollowedAt.IsZero())
+
+	_, list = get(fmt.Sprintf("/follows/%d/followers?limit=1&offset=2", authorID))
+	assert.Equal(t, int64(3), list.Count)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, followers[0], list.Users[0].ID)
+
+	_, list = get(fmt.Sprintf("/follows/%d/following", authorID))
+	assert.Equal(t, int64(1), list.Count)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, followers[0], list.Users[0].ID)
+
+	// Список недоступен, если профиль скрыт
+	setPrivacy(t, authorID, services.PrivacyUpdate{Profile: audience(models.PrivacyNobody)})
+	code, _ = get(fmt.Sprintf("/follows/%d/followers", authorID))
+	assert.Equal(t, http.StatusForbidden, code)
+
+	req, _ := http.NewRequest("POST", "/follows", bytes.NewBufferString(fmt.Sprintf(`{"user_id": %d}`, viewerID)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", viewerID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
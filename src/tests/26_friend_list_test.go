@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type friendListResponse struct {
+	Friends    []services.FriendListItem `json:"friends"`
+	Requests   []services.FriendListItem `json:"requests"`
+	NextCursor string                    `json:"next_cursor"`
+}
+
+func friendListIDs(items []services.FriendListItem) []int64 {
+	ids := []int64{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestFriendListPaginationAndSort(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+
+	userID, _ := CreateTestUser(t, "List", "Owner")
+	names := []string{"Boris", "Anna", "Dmitry", "Clara"}
+	friendIDs := make([]int64, len(names))
+	for i, name := range names {
+		friendIDs[i], _ = CreateTestUser(t, name, "Friend")
+		CreateFriendship(t, friendIDs[i], userID)
+		// Дружбы подтверждены в порядке создания
+		require.NoError(t, db.ORM.Model(&models.Friend{}).Where("user_id = ?", friendIDs[i]).
+			Update("approved_at", time.Now().Add(time.Duration(i-len(names))*time.Hour)).Error)
+	}
+	require.NoError(t, db.ORM.Model(&models.User{}).Where("id = ?", friendIDs[0]).Update("city", "Tver").Error)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.GET("/friends/list", handlers.GetFriends)
+	get := func(query string) (int, friendListResponse) {
+		req, _ := http.NewRequest("GET", "/friends/list"+query, nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response friendListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+	collect := func(sort string) []int64 {
+		ids := []int64{}
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			code, page := get(fmt.Sprintf("?sort=%s&limit=3&cursor=%s", sort, cursor))
+			require.Equal(t, http.StatusOK, code)
+			ids = append(ids, friendListIDs(page.Friends)...)
+			if page.NextCursor == "" {
+				return ids
+			}
+			cursor = page.NextCursor
+		}
+		t.Fatal("too many pages")
+		return nil
+	}
+
+	assert.Equal(t, []int64{friendIDs[3], friendIDs[2], friendIDs[1], friendIDs[0]}, collect(services.FriendSortRecent))
+	assert.Equal(t, []int64{friendIDs[1], friendIDs[0], friendIDs[3], friendIDs[2]}, collect(services.FriendSortAlpha))
+
+	_, page := get("?sort=alpha&limit=1")
+	require.Len(t, page.Friends, 1)
+	anna := page.Friends[0]
+	assert.Equal(t, "Anna", anna.FirstName)
+	assert.NotEmpty(t, anna.Nickname)
+	assert.False(t, anna.Since.IsZero())
+	// Онлайн-статус отдается, если пользователь его не скрыл
+	require.NotNil(t, anna.Online)
+	assert.False(t, *anna.Online)
+	_, page = get("?sort=alpha&limit=2")
+	assert.Equal(t, "Tver", page.Friends[1].City)
+
+	code, _ := get("?sort=popular")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("?cursor=garbage")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestPendingRequestsWithProfiles(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	prev := services.RedisClient
+	services.RedisClient = nil
+	t.Cleanup(func() { services.RedisClient = prev })
+	friendService := services.NewFriendService()
+
+	userID, _ := CreateTestUser(t, "Popular", "Recipient")
+	firstID, _ := CreateTestUser(t, "Zoe", "Requester")
+	secondID, _ := CreateTestUser(t, "Adam", "Requester")
+	hiddenID, _ := CreateTestUser(t, "Hidden", "Requester")
+	for _, requesterID := range []int64{firstID, secondID, hiddenID} {
+		require.NoError(t, friendService.AddFriend(requesterID, userID))
+	}
+	setPrivacy(t, hiddenID, services.PrivacyUpdate{Presence: audience(models.PrivacyNobody)})
+	// Исходящие заявки и подтвержденные дружбы во входящие не попадают
+	otherID, _ := CreateTestUser(t, "Other", "Person")
+	require.NoError(t, friendService.AddFriend(userID, otherID))
+
+	requests, err := friendService.GetPendingRequests(userID, services.FriendListParams{Sort: services.FriendSortAlpha})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{secondID, hiddenID, firstID}, friendListIDs(requests.Users))
+	assert.Empty(t, requests.NextCursor)
+	assert.NotNil(t, requests.Users[0].Online)
+	assert.Nil(t, requests.Users[1].Online)
+
+	require.NoError(t, friendService.ApproveFriend(userID, secondID))
+	requests, err = friendService.GetPendingRequests(userID, services.FriendListParams{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, requests.Users, 1)
+	assert.NotEmpty(t, requests.NextCursor)
+	requests, err = friendService.GetPendingRequests(userID, services.FriendListParams{Limit: 1, Cursor: requests.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, requests.Users, 1)
+	assert.Empty(t, requests.NextCursor)
+}
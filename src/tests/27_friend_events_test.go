@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"social/services"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFriendshipEvent читает следующее событие дружбы, пропуская события presence
+func readFriendshipEvent(t *testing.T, conn *websocket.Conn) services.FriendshipEvent {
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var event services.FriendshipEvent
+		require.NoError(t, json.Unmarshal(msg, &event))
+		if event.Event != "presence" {
+			return event
+		}
+	}
+}
+
+func TestFriendshipEventsPushedOverWebSocket(t *testing.T) {
+	server := setupPresenceTest(t)
+	friendService := services.NewFriendService()
+	requesterID, _ := CreateTestUser(t, "Eventful", "Requester")
+	recipientID, _ := CreateTestUser(t, "Notified", "Recipient")
+	requesterConn := connectPresenceWS(t, server, requesterID)
+	recipientConn := connectPresenceWS(t, server, recipientID)
+
+	require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	event := readFriendshipEvent(t, recipientConn)
+	assert.Equal(t, services.FriendEventRequested, event.Event)
+	assert.Equal(t, requesterID, event.UserID)
+	assert.Equal(t, recipientID, event.RecipientID)
+
+	require.NoError(t, friendService.CancelFriendRequest(requesterID, recipientID))
+	assert.Equal(t, services.FriendEventCancelled, readFriendshipEvent(t, recipientConn).Event)
+
+	require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	assert.Equal(t, services.FriendEventRequested, readFriendshipEvent(t, recipientConn).Event)
+	require.NoError(t, friendService.RejectFriend(recipientID, requesterID))
+	event = readFriendshipEvent(t, requesterConn)
+	assert.Equal(t, services.FriendEventRejected, event.Event)
+	assert.Equal(t, recipientID, event.UserID)
+
+	// Отказавший отправляет заявку сам, получатель принимает ее и затем удаляет друга
+	require.NoError(t, friendService.AddFriend(recipientID, requesterID))
+	assert.Equal(t, services.FriendEventRequested, readFriendshipEvent(t, requesterConn).Event)
+	require.NoError(t, friendService.ApproveFriend(requesterID, recipientID))
+	assert.Equal(t, services.FriendEventApproved, readFriendshipEvent(t, recipientConn).Event)
+	require.NoError(t, friendService.DeleteFriend(requesterID, recipientID))
+	event = readFriendshipEvent(t, recipientConn)
+	assert.Equal(t, services.FriendEventRemoved, event.Event)
+	assert.Equal(t, requesterID, event.UserID)
+
+	// Ошибочные изменения событий не порождают
+	assert.ErrorIs(t, friendService.ApproveFriend(requesterID, recipientID), services.ErrFriendRequestNotFound)
+	require.NoError(t, friendService.AddFriend(requesterID, recipientID))
+	assert.Equal(t, services.FriendEventRequested, readFriendshipEvent(t, recipientConn).Event)
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"social/config"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFriendshipChangesUpdateCachedFeeds(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	SetupTestRedis()
+	ctx := context.Background()
+	if err := services.RedisClient.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis is not available")
+	}
+	WithConfig(t, func(conf *config.Config) {
+		conf.Friends.FeedBackfillPosts = 2
+	})
+	friendService := services.NewFriendService()
+	postService := services.NewPostService()
+
+	readerID, _ := CreateTestUser(t, "Feed", "Reader")
+	oldFriendID, _ := CreateTestUser(t, "Old", "Friend")
+	newFriendID, _ := CreateTestUser(t, "New", "Friend")
+	CreateFriendship(t, readerID, oldFriendID)
+	createPost := func(userID int64, age time.Duration) int64 {
+		post := models.Post{UserID: userID, Content: "post", CreatedAt: time.Now().Add(-age)}
+		require.NoError(t, db.ORM.Create(&post).Error)
+		return post.ID
+	}
+	createPost(oldFriendID, time.Hour)
+	var newFriendPosts []int64
+	for i := 3; i > 0; i-- {
+		newFriendPosts = append(newFriendPosts, createPost(newFriendID, time.Duration(i)*time.Minute))
+	}
+
+	// Лента читателя закеширована до появления нового друга
+	_, err := postService.GetUserFeed(ctx, readerID, 0, 20)
+	require.NoError(t, err)
+	feedKey := fmt.Sprintf("%s%d", services.FEED_KEY_PREFIX, readerID)
+	inFeed := func(postID int64) bool {
+		_, err := services.RedisClient.ZScore(ctx, feedKey, strconv.FormatInt(postID, 10)).Result()
+		return err == nil
+	}
+	require.False(t, inFeed(newFriendPosts[2]))
+
+	require.NoError(t, friendService.AddFriend(newFriendID, readerID))
+	require.NoError(t, friendService.ApproveFriend(readerID, newFriendID))
+	assert.Eventually(t, func() bool {
+		return inFeed(newFriendPosts[1]) && inFeed(newFriendPosts[2])
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.False(t, inFeed(newFriendPosts[0]), "only the last feed_backfill_posts posts are added")
+
+	require.NoError(t, friendService.DeleteFriend(readerID, newFriendID))
+	assert.Eventually(t, func() bool {
+		return !inFeed(newFriendPosts[1]) && !inFeed(newFriendPosts[2])
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social/api/handlers"
+	"social/api/middleware"
+	"social/db"
+	"social/models"
+	"social/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPostEditRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TestAuthMiddleware())
+	r.PUT("/posts/:post_id", handlers.UpdatePost)
+	r.DELETE("/posts/:post_id", handlers.DeletePost)
+	r.GET("/posts/:post_id/revisions", handlers.GetPostRevisions)
+	return r
+}
+
+func doPostRequest(r *gin.Engine, method, path string, userID int64, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// readFeedEvent читает следующее событие с указанным типом, пропуская остальные
+func readFeedEvent(t *testing.T, conn *websocket.Conn, eventType string) services.FeedEvent {
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var event services.FeedEvent
+		require.NoError(t, json.Unmarshal(msg, &event))
+		if event.Event == eventType {
+			return event
+		}
+	}
+}
+
+func TestUpdatePostStoresRevisionsAndPushesEvent(t *testing.T) {
+	server := setupPresenceTest(t)
+	r := setupPostEditRouter()
+	authorID, _ := CreateTestUser(t, "Editing", "Author")
+	friendID, _ := CreateTestUser(t, "Reading", "Friend")
+	strangerID, _ := CreateTestUser(t, "Passing", "Stranger")
+	CreateFriendship(t, authorID, friendID)
+	post := models.Post{UserID: authorID, Content: "first", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, db.ORM.Create(&post).Error)
+	path := fmt.Sprintf("/posts/%d", post.ID)
+	friendConn := connectPresenceWS(t, server, friendID)
+
+	assert.Equal(t, http.StatusBadRequest, doPostRequest(r, "PUT", path, authorID, `{"content": ""}`).Code)
+	assert.Equal(t, http.StatusNotFound, doPostRequest(r, "PUT", path, friendID, `{"content": "hijacked"}`).Code)
+
+	w := doPostRequest(r, "PUT", path, authorID, `{"content": "second"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.Post
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "second", updated.Content)
+	assert.True(t, updated.UpdatedAt.After(post.UpdatedAt))
+
+	event := readFeedEvent(t, friendConn, services.FeedEventPostUpdated)
+	assert.Equal(t, post.ID, event.PostID)
+	assert.Equal(t, authorID, event.AuthorID)
+	assert.Equal(t, "second", event.Content)
+	require.NotNil(t, event.UpdatedAt)
+
+	// Тот же текст новую версию не создает
+	require.Equal(t, http.StatusOK, doPostRequest(r, "PUT", path, authorID, `{"content": "second"}`).Code)
+	require.Equal(t, http.StatusOK, doPostRequest(r, "PUT", path, authorID, `{"content": "third"}`).Code)
+
+	history := func(userID int64, query string) (int, services.PostHistory) {
+		w := doPostRequest(r, "GET", path+"/revisions"+query, userID, "")
+		var history services.PostHistory
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		}
+		return w.Code, history
+	}
+	code, result := history(authorID, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "third", result.Post.Content)
+	require.Len(t, result.Revisions, 2)
+	assert.Equal(t, "second", result.Revisions[0].Content)
+	assert.Equal(t, "first", result.Revisions[1].Content)
+
+	code, result = history(friendID, "?limit=1&offset=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, result.Revisions, 1)
+	assert.Equal(t, "first", result.Revisions[0].Content)
+
+	code, _ = history(strangerID, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Удаление поста удаляет и историю правок
+	require.Equal(t, http.StatusOK, doPostRequest(r, "DELETE", path, authorID, "").Code)
+	var count int64
+	require.NoError(t, db.ORM.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	code, _ = history(authorID, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestUpdatePostClearsCaptionOfMediaPost(t *testing.T) {
+	require.NoError(t, SetupFeedTestDB())
+	r := setupPostEditRouter()
+	authorID, _ := CreateTestUser(t, "Caption", "Author")
+	post := models.Post{UserID: authorID, Content: "caption", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, db.ORM.Create(&post).Error)
+	media := models.Media{
+		ID: "captionmedia", UserID: authorID, Kind: models.MediaKindPost, PostID: &post.ID,
+		ContentType: "image/png", StorageKey: "original", ThumbnailKey: "thumbnail", CreatedAt: time.Now(),
+	}
+	require.NoError(t, db.ORM.Create(&media).Error)
+
+	w := doPostRequest(r, "PUT", fmt.Sprintf("/posts/%d", post.ID), authorID, `{"content": ""}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.Post
+	require.NoError(t, db.ORM.First(&updated, post.ID).Error)
+	assert.Empty(t, updated.Content)
+	var revision models.PostRevision
+	require.NoError(t, db.ORM.Where("post_id = ?", post.ID).First(&revision).Error)
+	assert.Equal(t, "caption", revision.Content)
+
+	// Без поля content запрос по-прежнему некорректен
+	assert.Equal(t, http.StatusBadRequest, doPostRequest(r, "PUT", fmt.Sprintf("/posts/%d", post.ID), authorID, `{}`).Code)
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"social/config"
 	"social/db"
 	"social/models"
 	"social/services"
@@ -27,8 +28,17 @@ func SetupFeedTestDB() error {
 	if err != nil {
 		return err
 	}
-	// Автомиграция всех моделей включая Post, Message, ShardMap
-	err = database.AutoMigrate(&models.User{}, &models.Friend{}, &models.Post{}, &models.ShardMap{}, &models.Message{})
+	// Каждое новое подключение к :memory: открывает пустую базу, поэтому фоновые
+	// горутины (рассылка по лентам, WebSocket) должны использовать то же подключение
+	sqlDB, err := database.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	// Автомиграция всех моделей включая Post, Media, Message, ShardMap
+	err = database.AutoMigrate(&models.User{}, &models.Friend{}, &models.Post{}, &models.Media{}, &models.ShardMap{}, &models.Message{},
+		&models.PrivacySettings{}, &models.UserBlock{}, &models.SuggestionDismissal{}, &models.Follow{},
+		&models.PostRevision{})
 	if err != nil {
 		return err
 	}
@@ -98,3 +108,20 @@ func CreateFriendship(t *testing.T, userID, friendID int64) {
 	err := db.ORM.Create(friendship).Error
 	require.NoError(t, err)
 }
+
+// WithConfig подменяет конфигурацию на время теста
+func WithConfig(t *testing.T, update func(conf *config.Config)) {
+	prev := config.AppConfig
+	next := &config.Config{ShardCount: 1}
+	if prev != nil {
+		*next = *prev
+	}
+	update(next)
+	config.AppConfig = next
+	t.Cleanup(func() { config.AppConfig = prev })
+}
+
+// WithAuthConfig подменяет настройки аутентификации на время теста
+func WithAuthConfig(t *testing.T, update func(auth *config.AuthConfig)) {
+	WithConfig(t, func(conf *config.Config) { update(&conf.Auth) })
+}
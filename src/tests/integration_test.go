@@ -107,6 +107,12 @@ func createTestUser(t *testing.T) int64 {
 	return user.ID
 }
 
+func createTestAdmin(t *testing.T) int64 {
+	userID := createTestUser(t)
+	require.NoError(t, services.SetUserRole(context.Background(), userID, models.RoleAdmin))
+	return userID
+}
+
 func TestCreatePost(t *testing.T) {
 	router := setupTestRouter()
 	userID := createTestUser(t)
@@ -163,8 +169,10 @@ func TestGetFeed(t *testing.T) {
 
 func TestQueueStats(t *testing.T) {
 	router := setupTestRouter()
+	adminID := createTestAdmin(t)
 
 	req, _ := http.NewRequest("GET", "/api/v1/admin/queue/stats", nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", adminID))
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -206,8 +214,11 @@ func TestFeedCacheInvalidation(t *testing.T) {
 	router := setupTestRouter()
 	userID := createTestUser(t)
 
+	adminID := createTestAdmin(t)
+
 	// Инвалидируем кеш
 	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/v1/admin/cache/feed/%d", userID), nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", adminID))
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -223,8 +234,11 @@ func TestFeedRebuild(t *testing.T) {
 	router := setupTestRouter()
 	userID := createTestUser(t)
 
+	adminID := createTestAdmin(t)
+
 	// Перестраиваем ленту
 	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/v1/admin/feed/rebuild/%d", userID), nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", adminID))
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -235,3 +249,21 @@ func TestFeedRebuild(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "Feed rebuilt successfully", response["message"])
 }
+
+func TestAdminEndpointsRequireRole(t *testing.T) {
+	router := setupTestRouter()
+	userID := createTestUser(t)
+
+	// Без аутентификации
+	req, _ := http.NewRequest("POST", "/api/v1/admin/feed/rebuild-all", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Обычный пользователь
+	req, _ = http.NewRequest("POST", "/api/v1/admin/feed/rebuild-all", nil)
+	req.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}